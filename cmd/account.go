@@ -6,7 +6,10 @@ import (
 	"os"
 	"syscall"
 
+	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -22,18 +25,143 @@ var (
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			username := args[0]
+			role, _ := cmd.Flags().GetString("role")
 
 			fmt.Println("Username: " + username)
-			fmt.Print("Password: ")
+			password, err := readPassword("Password: ")
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			err = addAccount(username, password, role)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+
+	passwdAccountCmd = &cobra.Command{
+		Use:   "passwd username",
+		Short: "Change the password of account",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			username := args[0]
+			fmt.Println("Username: " + username)
+
+			oldPassword, err := readPassword("Old password: ")
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			newPassword, err := readPassword("New password: ")
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			err = changePassword(username, oldPassword, newPassword, "")
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Println("Password has been changed")
+		},
+	}
+
+	setRoleAccountCmd = &cobra.Command{
+		Use:   "set-role username role",
+		Short: "Change the role of account",
+		Long: "Change the role of account, which decides what it can do in web interface. " +
+			"Admin manages accounts, editor manages bookmarks and tags, " +
+			"while viewer can only read them.",
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			role, err := database.ParseRole(args[1])
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			err = DB.SetAccountRole(args[0], role)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("Account %s is now %s\n", args[0], role)
+		},
+	}
+
+	sessionsAccountCmd = &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage the login sessions of accounts",
+		Long: "Every login to web interface creates a session, which lasts until it expires, " +
+			"the account logs out or the session is revoked.",
+	}
+
+	listSessionsCmd = &cobra.Command{
+		Use:     "list [username]",
+		Short:   "Print the active sessions",
+		Long:    "Print the active sessions of account. If no arguments, sessions of all accounts will be printed.",
+		Aliases: []string{"print", "ls"},
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := printSessions(args, os.Stdout)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+
+	revokeSessionsCmd = &cobra.Command{
+		Use:   "revoke username [session-ids]",
+		Short: "Revoke the sessions of account",
+		Long: "Revoke the sessions of account, which logs it out of web interface. " +
+			"Accepts space-separated list of session IDs. " +
+			"If no session IDs, all sessions of the account will be revoked.",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			account, err := findAccount(args[0])
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			nRevoked, err := DB.DeleteSessions(account.ID, args[1:]...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d session(s) revoked\n", nRevoked)
+		},
+	}
 
-			bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
+	auditAccountCmd = &cobra.Command{
+		Use:   "audit [username]",
+		Short: "Print the audit log of logins",
+		Long: "Print the successful and failed logins to web interface, and the lockouts " +
+			"caused by too many failed logins, the newest first. " +
+			"If no arguments, events of all usernames will be printed.",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			page, err := pageFromFlags(cmd)
 			if err != nil {
 				cError.Println(err)
 				return
 			}
 
-			fmt.Println()
-			err = addAccount(username, string(bytePassword))
+			username := ""
+			if len(args) > 0 {
+				username = args[0]
+			}
+
+			err = printAuthEvents(username, page, os.Stdout)
 			if err != nil {
 				cError.Println(err)
 				return
@@ -94,32 +222,137 @@ var (
 
 func init() {
 	// Create flags
+	addAccountCmd.Flags().StringP("role", "r", "", "Role of account, either admin, editor or viewer. "+
+		"Defaults to admin for the first account and editor for the others")
 	printAccountCmd.Flags().StringP("search", "s", "", "Search accounts by username")
+	auditAccountCmd.Flags().IntP("limit", "l", 50, "Maximum number of events to print, 0 means no limit")
+	auditAccountCmd.Flags().IntP("page", "p", 1, "Page of events to print, used together with --limit")
 	deleteAccountCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and delete ALL accounts")
 
 	accountCmd.AddCommand(addAccountCmd)
+	accountCmd.AddCommand(passwdAccountCmd)
+	accountCmd.AddCommand(setRoleAccountCmd)
+	sessionsAccountCmd.AddCommand(listSessionsCmd)
+	sessionsAccountCmd.AddCommand(revokeSessionsCmd)
+
+	accountCmd.AddCommand(sessionsAccountCmd)
+	accountCmd.AddCommand(auditAccountCmd)
 	accountCmd.AddCommand(printAccountCmd)
 	accountCmd.AddCommand(deleteAccountCmd)
 	rootCmd.AddCommand(accountCmd)
 }
 
-func addAccount(username, password string) error {
+// addAccount creates new account. Empty role means admin for
+// the first account, so somebody can manage the others, or editor.
+func addAccount(username, password, strRole string) error {
 	if username == "" {
-		return fmt.Errorf("Username must not be empty")
+		return database.NewError(database.ErrValidation, "Username must not be empty")
 	}
 
-	if len(password) < 8 {
-		return fmt.Errorf("Password must be at least 8 characters")
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	role := database.RoleEditor
+	if strRole != "" {
+		parsedRole, err := database.ParseRole(strRole)
+		if err != nil {
+			return err
+		}
+		role = parsedRole
+	} else {
+		accounts, err := DB.GetAccounts("", false)
+		if err != nil {
+			return err
+		}
+
+		if len(accounts) == 0 {
+			role = database.RoleAdmin
+		}
+	}
+
+	err := DB.CreateAccount(username, password, role)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// changePassword replaces the password of account, after making sure the old password
+// matches the one saved in database. Then the login sessions of account are revoked,
+// except the one with keepSessionID, so whoever knew the old password is logged out.
+func changePassword(username, oldPassword, newPassword, keepSessionID string) error {
+	account, err := findAccount(username)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(oldPassword))
+	if err != nil {
+		return database.NewError(database.ErrValidation, "Old password doesn't match")
+	}
+
+	if err = validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	if err = DB.SetAccountPassword(username, newPassword); err != nil {
+		return err
 	}
 
-	err := DB.CreateAccount(username, password)
+	sessions, err := DB.GetSessions(account.ID)
 	if err != nil {
 		return err
 	}
 
+	revokedIDs := []string{}
+	for _, session := range sessions {
+		if session.ID != keepSessionID {
+			revokedIDs = append(revokedIDs, session.ID)
+		}
+	}
+
+	// Without IDs every session would be revoked
+	if len(revokedIDs) == 0 {
+		return nil
+	}
+
+	_, err = DB.DeleteSessions(account.ID, revokedIDs...)
+	return err
+}
+
+// validatePassword makes sure the password is strong enough to be saved.
+func validatePassword(password string) error {
+	if len(password) < 8 {
+		return database.NewError(database.ErrValidation, "Password must be at least 8 characters")
+	}
+
 	return nil
 }
 
+// readPassword asks user to type password in terminal, without echoing it.
+func readPassword(prompt string) (string, error) {
+	fmt.Print(prompt)
+	bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	return string(bytePassword), err
+}
+
+// findAccount returns the account with the specified username.
+func findAccount(username string) (model.Account, error) {
+	accounts, err := DB.GetAccounts(username, true)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	if len(accounts) == 0 {
+		return model.Account{}, database.NewError(database.ErrNotFound, fmt.Sprintf("Account %s doesn't exist", username))
+	}
+
+	return accounts[0], nil
+}
+
 func printAccounts(keyword string, wr io.Writer) error {
 	accounts, err := DB.GetAccounts(keyword, false)
 	if err != nil {
@@ -128,7 +361,63 @@ func printAccounts(keyword string, wr io.Writer) error {
 
 	for _, account := range accounts {
 		cIndex.Fprint(wr, "- ")
-		fmt.Fprintln(wr, account.Username)
+		fmt.Fprint(wr, account.Username)
+		cTag.Fprintf(wr, " (%s)\n", account.Role)
+	}
+
+	return nil
+}
+
+// printSessions prints the active sessions of the account in args, or of every account.
+func printSessions(args []string, wr io.Writer) error {
+	accountID := int64(0)
+	if len(args) > 0 {
+		account, err := findAccount(args[0])
+		if err != nil {
+			return err
+		}
+		accountID = account.ID
+	}
+
+	sessions, err := DB.GetSessions(accountID)
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) == 0 {
+		return fmt.Errorf("No active sessions")
+	}
+
+	for _, session := range sessions {
+		cIndex.Fprint(wr, "- ")
+		fmt.Fprint(wr, session.ID)
+		cTag.Fprintf(wr, " (%s)\n", session.Username)
+		fmt.Fprintf(wr, "  Logged in at %s, expires at %s\n", session.Created, session.Expires)
+	}
+
+	return nil
+}
+
+// printAuthEvents prints the audit log of logins with the username, or of every username.
+func printAuthEvents(username string, page database.Page, wr io.Writer) error {
+	events, err := DB.GetAuthEvents(username, page)
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		return fmt.Errorf("No events in audit log")
+	}
+
+	for _, event := range events {
+		cIndex.Fprintf(wr, "%s ", event.Created)
+		switch event.Event {
+		case authEventSuccess:
+			cTag.Fprint(wr, event.Event)
+		default:
+			cError.Fprint(wr, event.Event)
+		}
+		fmt.Fprintf(wr, " %s from %s: %s\n", event.Username, event.Address, event.Message)
 	}
 
 	return nil
@@ -2,8 +2,22 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	db "github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
 )
 
 func TestAddAccount(t *testing.T) {
@@ -17,7 +31,7 @@ func TestAddAccount(t *testing.T) {
 		{"abc", "fooBar123", ""},
 	}
 	for _, tt := range tests {
-		err := addAccount(tt.username, tt.password)
+		err := addAccount(tt.username, tt.password, "")
 		if err != nil {
 			if tt.want == "" {
 				t.Errorf("got unexpected error: %v", err)
@@ -34,7 +48,7 @@ func TestAddAccount(t *testing.T) {
 }
 
 func TestPrintAccounts(t *testing.T) {
-	if err := addAccount("foo", "fooBar123"); err != nil {
+	if err := addAccount("foo", "fooBar123", ""); err != nil {
 		t.Errorf("failed to add test account: %v", err)
 		return
 	}
@@ -48,3 +62,498 @@ func TestPrintAccounts(t *testing.T) {
 		t.Errorf("expected string containing 'foo', got '%s'", got)
 	}
 }
+
+func TestAccountOwnership(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	accountDB := map[string]db.Database{}
+	accountIDs := map[string]int64{}
+	for _, username := range []string{"alice", "bob"} {
+		if err := addAccount(username, "fooBar123", ""); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+
+		account, err := findAccount(username)
+		if err != nil {
+			t.Fatalf("failed to find test account: %v", err)
+		}
+
+		accountIDs[username] = account.ID
+		accountDB[username] = DB.ForAccount(account.ID)
+	}
+
+	// Each account can save the same URL, with its own tags
+	testbks := []struct {
+		username string
+		bookmark model.Bookmark
+	}{
+		{"alice", model.Bookmark{URL: "https://example.com/shared", Title: "Shared", Tags: []model.Tag{{Name: "go"}}}},
+		{"alice", model.Bookmark{URL: "https://example.com/private", Title: "Private", Tags: []model.Tag{{Name: "secret"}}}},
+		{"bob", model.Bookmark{URL: "https://example.com/shared", Title: "Shared", Tags: []model.Tag{{Name: "go"}}}},
+	}
+	bookmarkIDs := []string{}
+	for _, tb := range testbks {
+		book, err := addBookmark(accountDB[tb.username], tb.bookmark, true)
+		if err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+		bookmarkIDs = append(bookmarkIDs, strconv.FormatInt(book.ID, 10))
+	}
+
+	countBookmarks := func(database db.Database) int {
+		bookmarks, err := database.GetBookmarks(false, db.Page{})
+		if err != nil {
+			t.Fatalf("failed to get bookmarks: %v", err)
+		}
+		return len(bookmarks)
+	}
+
+	if alice, bob, all := countBookmarks(accountDB["alice"]), countBookmarks(accountDB["bob"]), countBookmarks(DB); alice != 2 || bob != 1 || all != 3 {
+		t.Errorf("expected 2, 1 and 3 bookmarks, got %d, %d and %d", alice, bob, all)
+	}
+
+	bobTags, err := accountDB["bob"].GetTags()
+	if err != nil || len(bobTags) != 1 || bobTags[0].Name != "go" || bobTags[0].NBookmarks != 1 {
+		t.Errorf("expected bob to only see his tag go, got %+v (%v)", bobTags, err)
+	}
+
+	// Bookmarks and tags of other account can't be changed
+	if err = accountDB["bob"].DeleteBookmarks(bookmarkIDs[1]); err != nil {
+		t.Errorf("got unexpected error: %v", err)
+	}
+	if countBookmarks(accountDB["alice"]) != 2 {
+		t.Errorf("expected bookmark of alice to survive deletion by bob")
+	}
+
+	stolen := "Stolen"
+	if _, err = updateBookmarks(accountDB["bob"], bookmarkIDs[1:2], model.BookmarkPatch{Title: &stolen}, nil, true, true, nil); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected not found error updating bookmark of alice, got %v", err)
+	}
+
+	aliceTags, err := accountDB["alice"].GetTags()
+	if err != nil || len(aliceTags) != 2 {
+		t.Fatalf("expected 2 tags of alice, got %+v (%v)", aliceTags, err)
+	}
+	if _, err = accountDB["bob"].RenameTag(aliceTags[1].ID, "public"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected not found error renaming tag of alice, got %v", err)
+	}
+
+	// Account that still owns bookmarks can't be deleted
+	if err = DB.DeleteAccounts("bob"); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("expected conflict deleting account with bookmarks, got %v", err)
+	}
+
+	// API only returns the bookmarks of the account that owns the token
+	jwtKey = []byte("test-key")
+	for _, tt := range []struct {
+		sub        int64
+		wantStatus int
+		wantTotal  int
+	}{
+		{accountIDs["bob"], http.StatusOK, 1},
+		{accountIDs["alice"], http.StatusOK, 2},
+		{0, http.StatusUnauthorized, 0},
+	} {
+		// Token of account zero can't be made by logging in, so it's signed manually
+		token := ""
+		if tt.sub > 0 {
+			token = signTestToken(t, tt.sub)
+		} else {
+			var err error
+			token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"exp": time.Now().Add(time.Hour).Unix(),
+				"sub": tt.sub,
+			}).SignedString(jwtKey)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+		}
+
+		r := httptest.NewRequest("GET", "/api/bookmarks", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiGetBookmarks(w, r, nil)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("account %d: expected status %d, got %d", tt.sub, tt.wantStatus, w.Code)
+			continue
+		}
+
+		page := model.BookmarkPage{}
+		if tt.wantStatus == http.StatusOK {
+			if err = json.NewDecoder(w.Body).Decode(&page); err != nil || page.Total != tt.wantTotal {
+				t.Errorf("account %d: expected %d bookmarks, got %d (%v)", tt.sub, tt.wantTotal, page.Total, err)
+			}
+		}
+	}
+}
+
+func TestCommandAccount(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	// Commands replace DB with the one limited to their account
+	rootDB := DB
+	defer func() { DB = rootDB }()
+
+	addFromCLI := func(url string) {
+		rootCmd.SetArgs([]string{"add", url, "--offline", "--title", "From CLI"})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("failed to run add command: %v", err)
+		}
+		DB = rootDB
+	}
+
+	// Without any account, the bookmark is taken by the first account
+	addFromCLI("http://127.0.0.1:1/before-account")
+	if err := addAccount("alice", "fooBar123", ""); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+
+	// With single account, it owns the bookmark
+	addFromCLI("http://127.0.0.1:1/single-account")
+
+	alice, err := findAccount("alice")
+	if err != nil {
+		t.Fatalf("failed to find test account: %v", err)
+	}
+
+	jwtKey = []byte("test-key")
+	r := httptest.NewRequest("GET", "/api/bookmarks", nil)
+	r.Header.Set("Authorization", "Bearer "+signTestToken(t, alice.ID))
+	w := httptest.NewRecorder()
+	apiGetBookmarks(w, r, nil)
+
+	page := model.BookmarkPage{}
+	if err = json.NewDecoder(w.Body).Decode(&page); err != nil || page.Total != 2 {
+		t.Errorf("expected alice to see 2 bookmarks added from CLI, got %d (%v)", page.Total, err)
+	}
+
+	// With several accounts, the owner must be chosen
+	if err = addAccount("bob", "fooBar123", ""); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+
+	for _, tt := range []struct {
+		username     string
+		needsAccount bool
+		want         string
+		wantErr      error
+	}{
+		{"", true, "", db.ErrValidation},
+		{"bob", true, "bob", nil},
+		{"", false, "", nil},
+		{"carol", false, "", db.ErrNotFound},
+	} {
+		account, err := commandAccount(tt.username, tt.needsAccount)
+		if !errors.Is(err, tt.wantErr) || account.Username != tt.want {
+			t.Errorf("%q, %v: expected account %q and error %v, got %q and %v",
+				tt.username, tt.needsAccount, tt.want, tt.wantErr, account.Username, err)
+		}
+	}
+}
+
+func TestAccountRoles(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	// First account becomes admin, the others editor, unless role is chosen
+	for _, tt := range []struct {
+		username string
+		role     string
+		want     db.Role
+		wantErr  bool
+	}{
+		{"admin", "", db.RoleAdmin, false},
+		{"editor", "", db.RoleEditor, false},
+		{"viewer", " Viewer ", db.RoleViewer, false},
+		{"owner", "owner", "", true},
+	} {
+		err := addAccount(tt.username, "fooBar123", tt.role)
+		if tt.wantErr {
+			if !errors.Is(err, db.ErrValidation) {
+				t.Errorf("%s: expected validation error, got %v", tt.username, err)
+			}
+			continue
+		}
+
+		account, err := findAccount(tt.username)
+		if err != nil || db.Role(account.Role) != tt.want {
+			t.Errorf("%s: expected role %s, got %q (%v)", tt.username, tt.want, account.Role, err)
+		}
+	}
+
+	if err := DB.SetAccountRole("nobody", db.RoleAdmin); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected not found error changing role of missing account, got %v", err)
+	}
+
+	// Viewer can read bookmarks, but only editor and admin can change them
+	jwtKey = []byte("test-key")
+	accountIDs := map[string]int64{}
+	for _, username := range []string{"admin", "editor", "viewer"} {
+		account, err := findAccount(username)
+		if err != nil {
+			t.Fatalf("failed to find test account: %v", err)
+		}
+		accountIDs[username] = account.ID
+	}
+
+	for _, tt := range []struct {
+		username   string
+		method     string
+		handler    func(http.ResponseWriter, *http.Request, httprouter.Params)
+		wantStatus int
+	}{
+		{"viewer", "GET", apiGetBookmarks, http.StatusOK},
+		{"viewer", "GET", apiGetTags, http.StatusOK},
+		{"viewer", "DELETE", apiDeleteBookmarks, http.StatusForbidden},
+		{"viewer", "DELETE", apiEmptyTrash, http.StatusForbidden},
+		{"editor", "DELETE", apiDeleteBookmarks, http.StatusOK},
+		{"admin", "DELETE", apiEmptyTrash, http.StatusOK},
+	} {
+		body := strings.NewReader("[]")
+		r := httptest.NewRequest(tt.method, "/api/test", body)
+		r.Header.Set("Authorization", "Bearer "+signTestToken(t, accountIDs[tt.username]))
+		w := httptest.NewRecorder()
+		tt.handler(w, r, nil)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s: expected status %d, got %d (%s)", tt.username, tt.method, tt.wantStatus, w.Code, w.Body)
+		}
+	}
+
+	// Changed role applies to the tokens that were already issued
+	if err := DB.SetAccountRole("viewer", db.RoleEditor); err != nil {
+		t.Fatalf("failed to change role: %v", err)
+	}
+
+	r := httptest.NewRequest("DELETE", "/api/bookmarks", strings.NewReader("[]"))
+	r.Header.Set("Authorization", "Bearer "+signTestToken(t, accountIDs["viewer"]))
+	w := httptest.NewRecorder()
+	apiDeleteBookmarks(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d after promoting viewer, got %d", http.StatusOK, w.Code)
+	}
+}
+
+// signTestToken logs in the account, returning token of its new session.
+func signTestToken(t *testing.T, accountID int64) string {
+	token, err := createSession(accountID, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	return token
+}
+
+func TestAccountAPI(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	if err := addAccount("admin", "fooBar123", ""); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+	if err := addAccount("viewer", "fooBar123", "viewer"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+
+	jwtKey = []byte("test-key")
+	tokens := map[string]string{}
+	for _, username := range []string{"admin", "viewer"} {
+		account, err := findAccount(username)
+		if err != nil {
+			t.Fatalf("failed to find test account: %v", err)
+		}
+		tokens[username] = signTestToken(t, account.ID)
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		method     string
+		body       string
+		handler    httprouter.Handle
+		wantStatus int
+		want       string
+	}{
+		{"viewer can't list accounts", "viewer", "GET", "", apiGetAccounts, http.StatusForbidden, ""},
+		{"viewer can't add account", "viewer", "POST", `{"username":"bob","password":"fooBar123"}`, apiInsertAccount, http.StatusForbidden, ""},
+		{"admin adds editor", "admin", "POST", `{"username":"bob","password":"fooBar123"}`, apiInsertAccount, http.StatusOK, `"role":"editor"`},
+		{"admin adds existing account", "admin", "POST", `{"username":"bob","password":"fooBar123"}`, apiInsertAccount, http.StatusConflict, ""},
+		{"admin adds account with short password", "admin", "POST", `{"username":"carol","password":"abc"}`, apiInsertAccount, http.StatusBadRequest, ""},
+		{"admin lists accounts without passwords", "admin", "GET", "", apiGetAccounts, http.StatusOK, `"username":"bob"`},
+		{"admin can't delete every account", "admin", "DELETE", `[]`, apiDeleteAccounts, http.StatusBadRequest, ""},
+		{"admin can't delete itself", "admin", "DELETE", `["bob","admin"]`, apiDeleteAccounts, http.StatusBadRequest, ""},
+		{"admin deletes account", "admin", "DELETE", `["bob"]`, apiDeleteAccounts, http.StatusOK, ""},
+		{"wrong old password", "viewer", "PUT", `{"oldPassword":"wrong","newPassword":"newPass123"}`, apiChangePassword, http.StatusBadRequest, ""},
+		{"short new password", "viewer", "PUT", `{"oldPassword":"fooBar123","newPassword":"abc"}`, apiChangePassword, http.StatusBadRequest, ""},
+		{"viewer changes password", "viewer", "PUT", `{"oldPassword":"fooBar123","newPassword":"newPass123"}`, apiChangePassword, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/accounts", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+tokens[tt.username])
+		w := httptest.NewRecorder()
+		tt.handler(w, r, nil)
+
+		got := w.Body.String()
+		if w.Code != tt.wantStatus || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: expected status %d with %q, got %d (%s)", tt.name, tt.wantStatus, tt.want, w.Code, got)
+		}
+		if strings.Contains(got, `"password"`) {
+			t.Errorf("%s: expected no password in response, got %s", tt.name, got)
+		}
+	}
+
+	if _, err := findAccount("bob"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected deleted account to be gone, got %v", err)
+	}
+
+	// New password is used for login, and can be changed again from command line
+	r := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"viewer","password":"newPass123"}`))
+	w := httptest.NewRecorder()
+	apiLogin(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected login with new password to succeed, got %d (%s)", w.Code, w.Body)
+	}
+
+	if err := changePassword("viewer", "fooBar123", "otherPass123", ""); !errors.Is(err, db.ErrValidation) {
+		t.Errorf("expected validation error with the replaced password, got %v", err)
+	}
+	if err := changePassword("viewer", "newPass123", "otherPass123", ""); err != nil {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	for _, username := range []string{"alice", "bob"} {
+		if err := addAccount(username, "fooBar123", ""); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+	}
+
+	// Every login creates new session
+	jwtKey = []byte("test-key")
+	login := func(username string) string {
+		body := fmt.Sprintf(`{"username":%q,"password":"fooBar123"}`, username)
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		apiLogin(w, r, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("failed to login as %s: %d (%s)", username, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	getTags := func(token string) int {
+		r := httptest.NewRequest("GET", "/api/tags", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiGetTags(w, r, nil)
+		return w.Code
+	}
+
+	aliceToken, aliceOtherToken, bobToken := login("alice"), login("alice"), login("bob")
+	alice, err := findAccount("alice")
+	if err != nil {
+		t.Fatalf("failed to find test account: %v", err)
+	}
+
+	sessions, err := DB.GetSessions(alice.ID)
+	if err != nil || len(sessions) != 2 || sessions[0].Username != "alice" {
+		t.Fatalf("expected 2 sessions of alice, got %+v (%v)", sessions, err)
+	}
+
+	b := bytes.NewBufferString("")
+	if err = printSessions(nil, b); err != nil || strings.Count(b.String(), "- ") != 3 {
+		t.Errorf("expected 3 printed sessions, got %q (%v)", b.String(), err)
+	}
+
+	// Logout only revokes the session of its token
+	r := httptest.NewRequest("POST", "/api/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+aliceToken)
+	w := httptest.NewRecorder()
+	apiLogout(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected logout to succeed, got %d (%s)", w.Code, w.Body)
+	}
+
+	if code := getTags(aliceToken); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d after logout, got %d", http.StatusUnauthorized, code)
+	}
+	if code := getTags(aliceOtherToken); code != http.StatusOK {
+		t.Errorf("expected other session to stay valid, got %d", code)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: aliceToken})
+	if err = checkToken(r); err == nil {
+		t.Errorf("expected cookie of revoked session to be refused")
+	}
+
+	// Revoking every session of account leaves the others alone
+	if n, err := DB.DeleteSessions(alice.ID); err != nil || n != 1 {
+		t.Errorf("expected 1 revoked session, got %d (%v)", n, err)
+	}
+	if code := getTags(aliceOtherToken); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d after revoking sessions, got %d", http.StatusUnauthorized, code)
+	}
+	if code := getTags(bobToken); code != http.StatusOK {
+		t.Errorf("expected session of bob to stay valid, got %d", code)
+	}
+
+	// Changing password logs out the other sessions, but not the one that changed it
+	bobOtherToken := login("bob")
+	r = httptest.NewRequest("PUT", "/api/accounts/me/password", strings.NewReader(`{"oldPassword":"fooBar123","newPassword":"newPass123"}`))
+	r.Header.Set("Authorization", "Bearer "+bobToken)
+	w = httptest.NewRecorder()
+	apiChangePassword(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected password to be changed, got %d (%s)", w.Code, w.Body)
+	}
+
+	if code := getTags(bobOtherToken); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d after changing password, got %d", http.StatusUnauthorized, code)
+	}
+	if code := getTags(bobToken); code != http.StatusOK {
+		t.Errorf("expected session that changed password to stay valid, got %d", code)
+	}
+
+	// Tokens signed with other key are refused, even with valid session
+	jwtKey = []byte("other-key")
+	if code := getTags(bobToken); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with other key, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestLoadJWTKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "shiori.key")
+
+	// Key is generated on first run, then loaded from the same file
+	key, err := loadJWTKey(keyFile)
+	if err != nil || len(key) < 32 {
+		t.Fatalf("expected new key, got %q (%v)", key, err)
+	}
+
+	loadedKey, err := loadJWTKey(keyFile)
+	if err != nil || !bytes.Equal(key, loadedKey) {
+		t.Errorf("expected saved key %q, got %q (%v)", key, loadedKey, err)
+	}
+
+	// Environment variable takes precedence over key file
+	os.Setenv("ENV_SHIORI_JWT_KEY", "short")
+	defer os.Unsetenv("ENV_SHIORI_JWT_KEY")
+	if _, err = loadJWTKey(keyFile); err == nil {
+		t.Errorf("expected error with short key")
+	}
+
+	envKey := strings.Repeat("k", 32)
+	os.Setenv("ENV_SHIORI_JWT_KEY", envKey)
+	if key, err = loadJWTKey(keyFile); err != nil || string(key) != envKey {
+		t.Errorf("expected key from environment, got %q (%v)", key, err)
+	}
+}
@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"fmt"
 	"github.com/RadhiFadlillah/go-readability"
+	"github.com/s-frostick/shiori/database"
 	"github.com/s-frostick/shiori/model"
 	"github.com/s-frostick/ytdl"
 	"github.com/spf13/cobra"
@@ -14,9 +14,10 @@ import (
 
 var (
 	addCmd = &cobra.Command{
-		Use:   "add url",
-		Short: "Bookmark the specified URL",
-		Args:  cobra.ExactArgs(1),
+		Use:         "add url",
+		Annotations: map[string]string{annotationNeedsAccount: "true"},
+		Short:       "Bookmark the specified URL",
+		Args:        cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			// Read flag and arguments
 			url := args[0]
@@ -38,7 +39,7 @@ var (
 			}
 
 			// Save new bookmark
-			result, err := addBookmark(bookmark, offline)
+			result, err := addBookmark(DB, bookmark, offline)
 			if err != nil {
 				cError.Println(err)
 				return
@@ -57,14 +58,14 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 }
 
-func addBookmark(base model.Bookmark, offline bool) (book model.Bookmark, err error) {
+func addBookmark(db database.Database, base model.Bookmark, offline bool) (book model.Bookmark, err error) {
 	// Prepare initial result
 	book = base
 
 	// Make sure URL valid
 	parsedURL, err := nurl.ParseRequestURI(book.URL)
 	if err != nil || parsedURL.Host == "" {
-		return book, fmt.Errorf("URL is not valid")
+		return book, database.NewError(database.ErrValidation, "URL is not valid")
 	}
 
 	// Clear UTM parameters from URL
@@ -100,8 +101,12 @@ func addBookmark(base model.Bookmark, offline bool) (book model.Bookmark, err er
 		}
 	}
 
-	// Save to database
-	book.ID, err = DB.CreateBookmark(book)
+	// Save to database, without anything in archived HTML that can run script
+	book.HTML = sanitizeHTML(book.HTML)
+	book.ID, err = db.CreateBookmark(book)
+	if err != nil {
+		return book, err
+	}
 
 	if strings.Contains(book.URL, "youtube.com") {
 		video := model.Video{}
@@ -120,9 +125,12 @@ func addBookmark(base model.Bookmark, offline bool) (book model.Bookmark, err er
 			"Your browser does not support the video tag.</video>"
 
 		books := []model.Bookmark{book}
-		_, err = DB.UpdateBookmarks(books)
+		_, err = db.UpdateBookmarks(books)
+		if err != nil {
+			return book, err
+		}
 
-		video.ID, err = DB.CreateVideo(book.ID, video)
+		video.ID, err = db.CreateVideo(book.ID, video)
 
 	}
 
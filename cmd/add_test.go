@@ -30,6 +30,13 @@ func TestAddBookMark(t *testing.T) {
 			},
 			true, "",
 		},
+		{
+			model.Bookmark{
+				URL:   "https://github.com/s-frostick/shiori",
+				Title: "Shiori",
+			},
+			true, "already exists",
+		},
 		{
 			model.Bookmark{
 				URL: "https://github.com/s-frostick/shiori/issues",
@@ -38,7 +45,7 @@ func TestAddBookMark(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		bk, err := addBookmark(tt.bookmark, tt.offline)
+		bk, err := addBookmark(DB, tt.bookmark, tt.offline)
 		if err != nil {
 			if tt.want == "" {
 				t.Errorf("got unexpected error: '%v'", err)
@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/s-frostick/shiori/assets"
+	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+)
+
+// apiV1Routes is the routes of versioned API, relative to /api/v1. Every route
+// must be described in openapi.json as well, which is checked by tests.
+var apiV1Routes = []struct {
+	method string
+	path   string
+	handle httprouter.Handle
+}{
+	{"GET", "/openapi.json", apiGetOpenAPI},
+	{"GET", "/bookmarks", apiGetBookmarks},
+	{"POST", "/bookmarks", apiCreateBookmark},
+	{"GET", "/bookmarks/:id", apiGetBookmark},
+	{"PUT", "/bookmarks/:id", apiReplaceBookmark},
+	{"PATCH", "/bookmarks/:id", apiPatchBookmark},
+	{"DELETE", "/bookmarks/:id", apiDeleteBookmark},
+	{"GET", "/bookmarks/:id/content", apiGetBookmarkContent},
+	{"POST", "/bookmarks/:id/refresh", apiRefreshBookmark},
+	{"GET", "/tags", apiGetTags},
+	{"PUT", "/tags/:id", apiRenameTag},
+	{"DELETE", "/tags/:id", apiDeleteTag},
+}
+
+// deprecated marks the response of route that has been replaced by versioned API,
+// pointing clients to the document of the API that replaces it.
+func deprecated(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+publicBasePath(r)+"/api/v1/openapi.json>; rel=\"deprecation\"")
+		handle(w, r, ps)
+	}
+}
+
+func apiGetOpenAPI(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	asset, err := assets.ReadFile("openapi.json")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Point the document to where API is served, which depends on base path and proxy
+	document := map[string]interface{}{}
+	err = json.Unmarshal(asset, &document)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	document["servers"] = []map[string]string{{"url": publicBasePath(r) + "/api/v1"}}
+	writeJSON(w, &document)
+}
+
+func apiCreateBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	// Decode request
+	request := model.Bookmark{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Save bookmark, shared right away if requested. Server waits for it when shutting down, so video isn't left half downloaded.
+	serverJobs.Add(1)
+	book, err := addBookmark(db, request, false)
+	serverJobs.Done()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/api/v1/bookmarks/%d", publicBasePath(r), book.ID))
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, &book)
+}
+
+func apiGetBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Shared bookmark can be read without login, like its cached page
+	bookmark, err := readableBookmark(r, strconv.FormatInt(id, 10), false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &bookmark)
+}
+
+func apiGetBookmarkContent(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bookmark, err := readableBookmark(r, strconv.FormatInt(id, 10), true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Bookmarks saved by older version might not be sanitized yet
+	writeJSON(w, &model.BookmarkContent{
+		ID:      bookmark.ID,
+		Content: bookmark.Content,
+		HTML:    sanitizeHTML(bookmark.HTML),
+	})
+}
+
+func apiReplaceBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request
+	request := model.Bookmark{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	if request.ID != 0 && request.ID != id {
+		writeError(w, database.NewError(database.ErrValidation, "Bookmark ID in body doesn't match the URL"))
+		return
+	}
+
+	// Every editable field is replaced, so the missing ones become empty
+	tags := request.Tags
+	if tags == nil {
+		tags = []model.Tag{}
+	}
+
+	book, err := patchBookmark(db, id, model.BookmarkPatch{
+		URL:      &request.URL,
+		Title:    &request.Title,
+		Excerpt:  &request.Excerpt,
+		Author:   &request.Author,
+		ImageURL: &request.ImageURL,
+		Tags:     &tags,
+		Public:   &request.Public,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &book)
+}
+
+func apiPatchBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request as merge patch, only the fields in it are changed
+	request := model.BookmarkPatch{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	book, err := patchBookmark(db, id, request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &book)
+}
+
+func apiDeleteBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Move bookmark to trash, as long as it exists
+	_, err = findBookmark(db, id, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = db.DeleteBookmarks(strconv.FormatInt(id, 10))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiRefreshBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get url parameter
+	_, dontOverwrite := r.URL.Query()["dont-overwrite"]
+	overwrite := !dontOverwrite
+
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := bookmarkIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Fetch bookmark from web again, which server waits for when shutting down
+	serverJobs.Add(1)
+	bookmarks, err := updateBookmarks(db, []string{strconv.FormatInt(id, 10)}, model.BookmarkPatch{}, nil, false, overwrite, nil)
+	serverJobs.Done()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &bookmarks[0])
+}
+
+// bookmarkIDFromParams reads the bookmark ID from URL parameter.
+func bookmarkIDFromParams(ps httprouter.Params) (int64, error) {
+	id, err := strconv.ParseInt(ps.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, database.NewError(database.ErrValidation, "Bookmark ID must be a positive number")
+	}
+
+	return id, nil
+}
+
+// findBookmark returns the bookmark with the specified ID, or ErrNotFound if it doesn't exist.
+func findBookmark(db database.Database, id int64, withContent bool) (model.Bookmark, error) {
+	bookmarks, err := db.GetBookmarks(withContent, database.Page{}, strconv.FormatInt(id, 10))
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+
+	if len(bookmarks) == 0 {
+		return model.Bookmark{}, database.NewError(database.ErrNotFound, fmt.Sprintf("Bookmark %d doesn't exist", id))
+	}
+
+	return bookmarks[0], nil
+}
+
+// patchBookmark applies the patch to bookmark with the specified ID, without fetching
+// anything from web. Returns the bookmark as saved in database.
+func patchBookmark(db database.Database, id int64, patch model.BookmarkPatch) (model.Bookmark, error) {
+	_, err := updateBookmarks(db, []string{strconv.FormatInt(id, 10)}, patch, nil, true, false, nil)
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+
+	// Read it again, so new tags come with their IDs
+	return findBookmark(db, id, false)
+}
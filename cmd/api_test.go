@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	db "github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+)
+
+func TestAPIErrors(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	loginAttempts = newLoginLimiter()
+	defer func() { loginAttempts = newLoginLimiter() }()
+	jwtKey = []byte("test-key")
+
+	tokens := map[string]string{}
+	for _, username := range []string{"editor", "viewer"} {
+		if err := addAccount(username, "fooBar123", username); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+
+		account, _ := findAccount(username)
+		tokens[username] = signTestToken(t, account.ID)
+	}
+
+	// Bookmark URLs point to closed port, so fetching them fails right away
+	editor, _ := findAccount("editor")
+	book, err := addBookmark(DB.ForAccount(editor.ID), model.Bookmark{URL: "http://127.0.0.1:1/existing", Title: "Existing"}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+	missingID := strconv.FormatInt(book.ID+1000, 10)
+
+	for _, tt := range []struct {
+		name        string
+		handler     httprouter.Handle
+		method      string
+		path        string
+		token       string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantDetails bool
+	}{
+		{"login with invalid JSON", apiLogin, "POST", "/api/login", "", `{"username":`, http.StatusBadRequest, "invalid_request", true},
+		{"login with wrong password", apiLogin, "POST", "/api/login", "", `{"username":"editor","password":"wrong"}`, http.StatusUnauthorized, "unauthorized", false},
+		{"get without token", apiGetBookmarks, "GET", "/api/bookmarks", "", "", http.StatusUnauthorized, "unauthorized", false},
+		{"get with invalid token", apiGetBookmarks, "GET", "/api/bookmarks", "invalid", "", http.StatusUnauthorized, "unauthorized", false},
+		{"get with invalid sort", apiGetBookmarks, "GET", "/api/bookmarks?sort=random", tokens["viewer"], "", http.StatusBadRequest, "invalid_request", false},
+		{"insert by viewer", apiInsertBookmarks, "POST", "/api/bookmarks", tokens["viewer"], `{"url":"http://127.0.0.1:1/new"}`, http.StatusForbidden, "forbidden", false},
+		{"insert with invalid JSON", apiInsertBookmarks, "POST", "/api/bookmarks", tokens["editor"], `{"url":1}`, http.StatusBadRequest, "invalid_request", true},
+		{"insert with invalid URL", apiInsertBookmarks, "POST", "/api/bookmarks", tokens["editor"], `{"url":"not a url"}`, http.StatusBadRequest, "invalid_request", false},
+		{"insert existing URL", apiInsertBookmarks, "POST", "/api/bookmarks", tokens["editor"], `{"url":"http://127.0.0.1:1/existing"}`, http.StatusConflict, "conflict", false},
+		{"update missing bookmark", apiUpdateBookmarks, "PUT", "/api/bookmarks", tokens["editor"], `{"id":` + missingID + `}`, http.StatusNotFound, "not_found", false},
+		{"update with invalid JSON", apiUpdateBookmarks, "PUT", "/api/bookmarks", tokens["editor"], `[]`, http.StatusBadRequest, "invalid_request", true},
+		{"delete by viewer", apiDeleteBookmarks, "DELETE", "/api/bookmarks", tokens["viewer"], `["1"]`, http.StatusForbidden, "forbidden", false},
+		{"delete invalid index", apiDeleteBookmarks, "DELETE", "/api/bookmarks", tokens["editor"], `["abc"]`, http.StatusBadRequest, "invalid_index", false},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		w := httptest.NewRecorder()
+		tt.handler(w, r, nil)
+
+		response := model.ErrorResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: expected JSON error, got %q (%v)", tt.name, w.Body, err)
+			continue
+		}
+
+		if w.Code != tt.wantStatus || response.Code != tt.wantCode || response.Message == "" ||
+			(response.Details != nil) != tt.wantDetails {
+			t.Errorf("%s: expected %d %s, got %d %+v", tt.name, tt.wantStatus, tt.wantCode, w.Code, response)
+		}
+
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+			t.Errorf("%s: expected JSON content type, got %s", tt.name, contentType)
+		}
+	}
+}
+
+func TestAPIInternalError(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+	account, _ := findAccount("alice")
+	token := signTestToken(t, account.ID)
+
+	// Database that fails every query
+	file, err := ioutil.TempFile("", "shiori-closed-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temporary database: %v", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	closedDB, err := db.OpenSQLiteDatabase(file.Name())
+	if err != nil {
+		t.Fatalf("failed to open temporary database: %v", err)
+	}
+	closedDB.Close()
+
+	testDB := DB
+	DB = closedDB
+	defer func() { DB = testDB }()
+
+	for name, handler := range map[string]httprouter.Handle{
+		"login":  apiLogin,
+		"get":    apiGetBookmarks,
+		"insert": apiInsertBookmarks,
+		"update": apiUpdateBookmarks,
+		"delete": apiDeleteBookmarks,
+	} {
+		body := `{"username":"alice","password":"fooBar123"}`
+		if name != "login" {
+			body = `{"id":1,"url":"http://127.0.0.1:1/"}`
+		}
+
+		r := httptest.NewRequest("POST", "/api/test", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r, nil)
+
+		// Cause of internal error is logged, not sent to client
+		response := model.ErrorResponse{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil || w.Code != http.StatusInternalServerError || response.Code != "internal_error" ||
+			response.Message != "Internal server error" || response.Details != nil {
+			t.Errorf("%s: expected internal error, got %d %q (%v)", name, w.Code, w.Body, err)
+		}
+	}
+}
+
+func TestAPIV1Bookmarks(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	tokens := map[string]string{}
+	for username, role := range map[string]string{"alice": "editor", "bob": "editor", "viewer": "viewer"} {
+		if err := addAccount(username, "fooBar123", role); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+
+		account, _ := findAccount(username)
+		tokens[username] = signTestToken(t, account.ID)
+	}
+
+	router := newRouter()
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) model.Bookmark {
+		book := model.Bookmark{}
+		if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+			t.Fatalf("expected bookmark, got %d %q (%v)", w.Code, w.Body, err)
+		}
+		return book
+	}
+
+	tagNames := func(book model.Bookmark) string {
+		names := []string{}
+		for _, tag := range book.Tags {
+			names = append(names, tag.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// New bookmark can be found in Location header. Its URL points to closed port, so fetching it fails right away.
+	w := request("POST", "/api/v1/bookmarks", tokens["alice"], `{"url":"http://127.0.0.1:1/article","title":"Article","excerpt":"Old","tags":[{"name":"Go"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected bookmark to be created, got %d %q", w.Code, w.Body)
+	}
+
+	book := decode(w)
+	path := "/api/v1/bookmarks/" + strconv.FormatInt(book.ID, 10)
+	if location := w.Header().Get("Location"); location != path {
+		t.Errorf("expected location %s, got %s", path, location)
+	}
+
+	if book = decode(request("GET", path, tokens["viewer"], "")); book.ID != 0 {
+		t.Errorf("expected bookmark of other account to be hidden, got %+v", book)
+	}
+
+	if book = decode(request("GET", path, tokens["alice"], "")); book.Title != "Article" || tagNames(book) != "go" || book.Public {
+		t.Errorf("unexpected bookmark %+v", book)
+	}
+
+	// Bookmark can be shared as soon as it's created
+	w = request("POST", "/api/v1/bookmarks", tokens["alice"], `{"url":"http://127.0.0.1:1/shared","title":"Shared","public":true}`)
+	if book = decode(w); w.Code != http.StatusCreated || !book.Public {
+		t.Fatalf("expected shared bookmark to be created, got %d %q", w.Code, w.Body)
+	}
+	if book = decode(request("GET", w.Header().Get("Location"), "", "")); book.Title != "Shared" || !book.Public {
+		t.Errorf("expected new shared bookmark to be read without login, got %+v", book)
+	}
+
+	// PATCH only changes the fields in request
+	w = request("PATCH", path, tokens["alice"], `{"title":"New title","tags":[{"name":"Dev / Go"},{"name":"news"}]}`)
+	if book = decode(w); w.Code != http.StatusOK || book.Title != "New title" || book.Excerpt != "Old" ||
+		book.URL != "http://127.0.0.1:1/article" || tagNames(book) != "dev/go,news" {
+		t.Errorf("unexpected patched bookmark %d %+v", w.Code, book)
+	}
+
+	for _, tag := range book.Tags {
+		if tag.ID == 0 {
+			t.Errorf("expected saved tag to have ID, got %+v", tag)
+		}
+	}
+
+	// Shared bookmark and its content can be read without login
+	if book = decode(request("PATCH", path, tokens["alice"], `{"public":true}`)); !book.Public || book.Title != "New title" {
+		t.Errorf("expected bookmark to be shared, got %+v", book)
+	}
+
+	// Null in merge patch clears the field
+	w = request("PATCH", path, tokens["alice"], `{"excerpt":null,"author":"Alice"}`)
+	if book = decode(w); book.Excerpt != "" || book.Author != "Alice" || book.Title != "New title" || !book.Public {
+		t.Errorf("expected excerpt to be cleared, got %d %+v", w.Code, book)
+	}
+
+	w = request("GET", path+"/content", "", "")
+	content := model.BookmarkContent{}
+	if err := json.Unmarshal(w.Body.Bytes(), &content); err != nil || w.Code != http.StatusOK || content.ID != book.ID {
+		t.Errorf("expected content of shared bookmark, got %d %q (%v)", w.Code, w.Body, err)
+	}
+
+	// PUT replaces every editable field
+	w = request("PUT", path, tokens["alice"], `{"url":"http://127.0.0.1:1/moved?utm_source=feed","title":"Moved"}`)
+	if book = decode(w); w.Code != http.StatusOK || book.URL != "http://127.0.0.1:1/moved" || book.Title != "Moved" ||
+		book.Excerpt != "" || book.Public || len(book.Tags) != 0 {
+		t.Errorf("unexpected replaced bookmark %d %+v", w.Code, book)
+	}
+
+	// Invalid requests are refused, and nothing is changed
+	for _, tt := range []struct {
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"GET", "/api/v1/bookmarks/abc", tokens["alice"], "", http.StatusBadRequest},
+		{"GET", "/api/v1/bookmarks/0", tokens["alice"], "", http.StatusBadRequest},
+		{"GET", path, "", "", http.StatusUnauthorized},
+		{"PATCH", path, tokens["alice"], `{"title":" "}`, http.StatusBadRequest},
+		{"PATCH", path, tokens["alice"], `{"url":"not a url"}`, http.StatusBadRequest},
+		{"PATCH", path, tokens["alice"], `{"tags":"go"}`, http.StatusBadRequest},
+		{"PATCH", path, tokens["alice"], `{"titel":"Typo"}`, http.StatusBadRequest},
+		{"PATCH", path, tokens["viewer"], `{"title":"Viewer"}`, http.StatusForbidden},
+		{"PATCH", path, tokens["bob"], `{"title":"Bob"}`, http.StatusNotFound},
+		{"PUT", path, tokens["alice"], `{"id":1000000,"url":"http://127.0.0.1:1/other","title":"Other"}`, http.StatusBadRequest},
+		{"DELETE", path, tokens["bob"], "", http.StatusNotFound},
+	} {
+		if w := request(tt.method, tt.path, tt.token, tt.body); w.Code != tt.wantStatus {
+			t.Errorf("%s %s %s: expected status %d, got %d %q", tt.method, tt.path, tt.body, tt.wantStatus, w.Code, w.Body)
+		}
+	}
+
+	if book = decode(request("GET", path, tokens["alice"], "")); book.Title != "Moved" {
+		t.Errorf("expected refused requests to keep bookmark, got %+v", book)
+	}
+
+	// Deleted bookmark is moved to trash
+	if w = request("DELETE", path, tokens["alice"], ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected bookmark to be deleted, got %d %q", w.Code, w.Body)
+	}
+	if w = request("GET", path, tokens["alice"], ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected deleted bookmark to be missing, got %d %q", w.Code, w.Body)
+	}
+	if w = request("DELETE", path, tokens["alice"], ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected bookmark to be deleted once, got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestAPIDeprecatedRoutes(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+	account, _ := findAccount("alice")
+	token := signTestToken(t, account.ID)
+
+	router := newRouter()
+	for _, tt := range []struct {
+		path           string
+		wantDeprecated bool
+	}{
+		{"/api/bookmarks", true},
+		{"/api/tags", true},
+		{"/api/v1/bookmarks", false},
+		{"/api/v1/tags", false},
+		{"/api/trash", false},
+	} {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		deprecated := w.Header().Get("Deprecation") == "true" &&
+			w.Header().Get("Link") == `</api/v1/openapi.json>; rel="deprecation"`
+		if w.Code != http.StatusOK || deprecated != tt.wantDeprecated {
+			t.Errorf("%s: expected status %d and deprecated %v, got %d %v", tt.path, http.StatusOK, tt.wantDeprecated, w.Code, w.Header())
+		}
+	}
+}
+
+func TestLegacyUpdateExcerpt(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+	account, _ := findAccount("alice")
+	token := signTestToken(t, account.ID)
+
+	// Fetching the URL fails right away, so the saved excerpt stands for the fetched one
+	book, err := addBookmark(DB.ForAccount(account.ID), model.Bookmark{URL: "http://127.0.0.1:1/legacy", Title: "Title", Excerpt: "Saved"}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+	id := strconv.FormatInt(book.ID, 10)
+
+	router := newRouter()
+	for _, tt := range []struct {
+		name        string
+		query       string
+		body        string
+		wantExcerpt string
+	}{
+		{"empty excerpt is kept", "", `{"id":` + id + `,"excerpt":""}`, "Saved"},
+		{"missing excerpt is kept", "", `{"id":` + id + `}`, "Saved"},
+		{"magic excerpt is kept", "", `{"id":` + id + `,"excerpt":"empty"}`, "Saved"},
+		{"excerpt isn't changed without overwrite", "?dont-overwrite", `{"id":` + id + `,"excerpt":"Ignored"}`, "Saved"},
+		{"excerpt is changed", "", `{"id":` + id + `,"excerpt":"Changed"}`, "Changed"},
+	} {
+		r := httptest.NewRequest("PUT", "/api/bookmarks"+tt.query, strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		saved, err := findBookmark(DB, book.ID, false)
+		if err != nil {
+			t.Fatalf("%s: failed to read bookmark: %v", tt.name, err)
+		}
+		if w.Code != http.StatusOK || saved.Excerpt != tt.wantExcerpt {
+			t.Errorf("%s: expected excerpt %q, got %d %q (%s)", tt.name, tt.wantExcerpt, w.Code, saved.Excerpt, w.Body)
+		}
+	}
+
+	// The magic value only means something to the deprecated route, not to the patch
+	magic := "empty"
+	saved, err := patchBookmark(DB, book.ID, model.BookmarkPatch{Excerpt: &magic})
+	if err != nil || saved.Excerpt != magic {
+		t.Errorf("expected patch to save excerpt %q, got %q (%v)", magic, saved.Excerpt, err)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	basePath = "/shiori"
+	defer func() { basePath = "" }()
+
+	r := httptest.NewRequest("GET", "/api/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, r)
+
+	document := struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected OpenAPI document, got %d %q (%v)", w.Code, w.Body, err)
+	}
+
+	if len(document.Servers) != 1 || document.Servers[0].URL != "/shiori/api/v1" {
+		t.Errorf("expected server in base path, got %+v", document.Servers)
+	}
+
+	// Every route is documented, and every documented operation is routed
+	nOperations := 0
+	for _, operations := range document.Paths {
+		for method := range operations {
+			if method != "parameters" {
+				nOperations++
+			}
+		}
+	}
+
+	for _, route := range apiV1Routes {
+		path := regexp.MustCompile(`:(\w+)`).ReplaceAllString(route.path, "{$1}")
+		if _, documented := document.Paths[path][strings.ToLower(route.method)]; !documented {
+			t.Errorf("expected %s %s to be documented", route.method, path)
+		}
+	}
+
+	if nOperations != len(apiV1Routes) {
+		t.Errorf("expected %d documented operations, got %d", len(apiV1Routes), nOperations)
+	}
+}
@@ -4,25 +4,76 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
-	db "github.com/s-frostick/shiori/database"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	db "github.com/s-frostick/shiori/database"
 )
 
 func TestMain(m *testing.M) {
+	// By default tests run against SQLite. Set ENV_SHIORI_TEST_MYSQL_DSN or
+	// ENV_SHIORI_TEST_PG_DSN to run the same tests against MySQL or PostgreSQL.
 	testDBFile := "shiori_test.db"
-	sqliteDB, err := db.OpenSQLiteDatabase(testDBFile)
-	if err != nil {
-		fmt.Printf("failed to create tests DB: %v", err)
+	if dsn, found := os.LookupEnv("ENV_SHIORI_TEST_MYSQL_DSN"); found {
+		mysqlDB, err := db.OpenMySQLDatabase(dsn)
+		if err != nil {
+			fmt.Printf("failed to connect to tests DB: %v", err)
+			os.Exit(1)
+		}
+		DB = mysqlDB
+		testDBFile = ""
+	} else if dsn, found := os.LookupEnv("ENV_SHIORI_TEST_PG_DSN"); found {
+		pgDB, err := db.OpenPostgresDatabase(dsn)
+		if err != nil {
+			fmt.Printf("failed to connect to tests DB: %v", err)
+			os.Exit(1)
+		}
+		DB = pgDB
+		testDBFile = ""
+	} else {
+		sqliteDB, err := db.OpenSQLiteDatabase(testDBFile)
+		if err != nil {
+			fmt.Printf("failed to create tests DB: %v", err)
+			os.Exit(1)
+		}
+		DB = sqliteDB
+	}
+
+	if _, err := DB.Migrate(); err != nil {
+		fmt.Printf("failed to migrate tests DB: %v", err)
 		os.Exit(1)
 	}
-	DB = sqliteDB
 
+	clearTestData()
 	code := m.Run()
+	clearTestData()
 
-	if err := os.Remove(testDBFile); err != nil {
-		fmt.Printf("failed to delete tests DB: %v", err)
+	if testDBFile != "" {
+		if err := os.Remove(testDBFile); err != nil {
+			fmt.Printf("failed to delete tests DB: %v", err)
+		}
 	}
 	os.Exit(code)
+}
+
+// clearTestData removes every bookmark, tag and account, so tests that
+// run against a shared server always start from an empty database.
+func clearTestData() {
+	if err := DB.DeleteBookmarks(); err != nil {
+		fmt.Printf("failed to clear test bookmarks: %v", err)
+	}
+
+	if _, err := DB.PurgeBookmarks(time.Time{}); err != nil {
+		fmt.Printf("failed to purge test bookmarks: %v", err)
+	}
 
+	if _, err := DB.PruneTags(); err != nil {
+		fmt.Printf("failed to prune test tags: %v", err)
+	}
+
+	if err := DB.DeleteAccounts(); err != nil {
+		fmt.Printf("failed to clear test accounts: %v", err)
+	}
 }
@@ -10,8 +10,9 @@ var (
 	deleteCmd = &cobra.Command{
 		Use:   "delete [indices]",
 		Short: "Delete the saved bookmarks",
-		Long: "Delete bookmarks. " +
-			"When a record is deleted, the last record is moved to the removed index. " +
+		Long: "Delete bookmarks by moving them to trash. " +
+			"Use trash command to restore them or remove them permanently. " +
+			"The index of a bookmark never changes, deleting a bookmark doesn't affect the index of the others. " +
 			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
 			"If no arguments, all records will be deleted.",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -21,7 +22,7 @@ var (
 			// If no arguments, confirm to user
 			if len(args) == 0 && !skipConfirmation {
 				confirmDelete := ""
-				fmt.Print("Remove ALL bookmarks? (y/n): ")
+				fmt.Print("Move ALL bookmarks to trash? (y/n): ")
 				fmt.Scanln(&confirmDelete)
 
 				if confirmDelete != "y" {
@@ -40,6 +41,6 @@ var (
 )
 
 func init() {
-	deleteCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and delete ALL bookmarks")
+	deleteCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and move ALL bookmarks to trash")
 	rootCmd.AddCommand(deleteCmd)
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/s-frostick/shiori/database"
 	"github.com/s-frostick/shiori/model"
 	"github.com/spf13/cobra"
 )
@@ -34,7 +35,7 @@ func init() {
 
 func exportBookmarks(dstPath string) error {
 	// Read bookmarks from database
-	bookmarks, err := DB.GetBookmarks(false)
+	bookmarks, err := DB.GetBookmarks(false, database.Page{})
 	if err != nil {
 		return err
 	}
@@ -74,16 +75,67 @@ func exportBookmarks(dstPath string) error {
 		`<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">` +
 		`<TITLE>Bookmarks</TITLE>` +
 		`<H1>Bookmarks</H1>` +
-		`<DL><p>` +
-		`{{range $book := .}}` +
+		`<DL><p>{{template "folder" .}}</DL><p>` +
+		`{{define "folder"}}` +
+		`{{range $folder := .Folders}}` +
+		`<DT><H3>{{$folder.Name}}</H3><DL><p>{{template "folder" $folder}}</DL><p>` +
+		`{{end}}` +
+		`{{range $book := .Bookmarks}}` +
 		`<DT><A HREF="{{$book.URL}}" ADD_DATE="{{unix $book.Modified}}" TAGS="{{combine $book.Tags}}">{{$book.Title}}</A>` +
 		`{{if gt (len $book.Excerpt) 0}}<DD>{{$book.Excerpt}}{{end}}{{end}}` +
-		`</DL><p>`
+		`{{end}}`
 
 	tpl, err := template.New("export").Funcs(funcMap).Parse(tplFile)
 	if err != nil {
 		return err
 	}
 
-	return tpl.Execute(dstFile, &bookmarks)
+	return tpl.Execute(dstFile, exportFolders(bookmarks))
+}
+
+// exportFolder is a folder in the exported file, which is made from hierarchical tag.
+type exportFolder struct {
+	Name      string
+	Folders   []*exportFolder
+	Bookmarks []model.Bookmark
+}
+
+// exportFolders arranges the bookmarks into nested folders. Each bookmark is put in the
+// folder of its deepest tag, so bookmark tagged "dev/go/testing" ends up in folder
+// "testing" inside "go" inside "dev". Bookmarks without tag stay at the top level.
+func exportFolders(bookmarks []model.Bookmark) *exportFolder {
+	root := &exportFolder{}
+	for _, book := range bookmarks {
+		folderTag := ""
+		for _, tag := range book.Tags {
+			depth, folderDepth := strings.Count(tag.Name, "/"), strings.Count(folderTag, "/")
+			if folderTag == "" || depth > folderDepth || (depth == folderDepth && tag.Name < folderTag) {
+				folderTag = tag.Name
+			}
+		}
+
+		folder := root
+		if folderTag != "" {
+			for _, name := range strings.Split(folderTag, "/") {
+				folder = folder.subfolder(name)
+			}
+		}
+
+		folder.Bookmarks = append(folder.Bookmarks, book)
+	}
+
+	return root
+}
+
+// subfolder returns the folder with the specified name, creating it if it doesn't exist yet.
+func (f *exportFolder) subfolder(name string) *exportFolder {
+	for _, folder := range f.Folders {
+		if folder.Name == name {
+			return folder
+		}
+	}
+
+	folder := &exportFolder{Name: name}
+	f.Folders = append(f.Folders, folder)
+	return folder
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -8,15 +9,17 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/s-frostick/shiori/database"
 	"github.com/s-frostick/shiori/model"
 	"github.com/spf13/cobra"
 )
 
 var (
 	importCmd = &cobra.Command{
-		Use:   "import source-file",
-		Short: "Import bookmarks from HTML file in Netscape Bookmark format",
-		Args:  cobra.ExactArgs(1),
+		Use:         "import source-file",
+		Annotations: map[string]string{annotationNeedsAccount: "true"},
+		Short:       "Import bookmarks from HTML file in Netscape Bookmark format",
+		Args:        cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			generateTag := cmd.Flags().Changed("generate-tag")
 
@@ -40,7 +43,7 @@ var (
 )
 
 func init() {
-	importCmd.Flags().BoolP("generate-tag", "t", false, "Auto generate tag from bookmark's category")
+	importCmd.Flags().BoolP("generate-tag", "t", false, "Auto generate hierarchical tag from bookmark's folders")
 	importCmd.Flags().BoolP("shaarli", "s", false, "Import tags from shaarli, remove extra hash tag")
 	rootCmd.AddCommand(importCmd)
 }
@@ -64,7 +67,6 @@ func importBookmarks(pth string, generateTag bool, shaarli bool) error {
 	doc.Find("dt>a").Each(func(_ int, a *goquery.Selection) {
 		// Get related elements
 		dt := a.Parent()
-		dl := dt.Parent()
 
 		// Get metadata
 		title := a.Text()
@@ -94,16 +96,20 @@ func importBookmarks(pth string, generateTag bool, shaarli bool) error {
 			excerpt = dd.Text()
 		}
 
-		// Get category name for this bookmark
-		// and add it as tags (if necessary)
-		category := ""
-		if dtCategory := dl.Prev(); dtCategory.Is("h3") {
-			category = dtCategory.Text()
-			category = normalizeSpace(category)
-			category = strings.ToLower(category)
-			category = strings.Replace(category, " ", "-", -1)
-		}
+		// Get the folders that contain this bookmark, from the outermost one,
+		// and add them as hierarchical tag (if necessary), e.g. "dev/go/testing"
+		folders := []string{}
+		a.ParentsFiltered("dl").Each(func(_ int, dl *goquery.Selection) {
+			if h3 := dl.Prev(); h3.Is("h3") {
+				folder := normalizeSpace(h3.Text())
+				folder = strings.ToLower(folder)
+				folder = strings.Replace(folder, " ", "-", -1)
+				folder = strings.Replace(folder, "/", "-", -1)
+				folders = append([]string{folder}, folders...)
+			}
+		})
 
+		category := strings.Join(folders, "/")
 		if category != "" && generateTag {
 			tags = append(tags, model.Tag{Name: category})
 		}
@@ -122,12 +128,17 @@ func importBookmarks(pth string, generateTag bool, shaarli bool) error {
 
 	// Save bookmarks to database
 	for _, book := range bookmarks {
-		result, err := addBookmark(book, true)
-		if err != nil {
+		result, err := addBookmark(DB, book, true)
+		if errors.Is(err, database.ErrConflict) {
 			cError.Printf("URL %s already exists\n\n", book.URL)
 			continue
 		}
 
+		if err != nil {
+			cError.Printf("Failed to import %s: %v\n\n", book.URL, err)
+			continue
+		}
+
 		printBookmark(result)
 	}
 
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"io/ioutil"
+	fp "path/filepath"
+	"strings"
+	"testing"
+
+	db "github.com/s-frostick/shiori/database"
+)
+
+func TestImportExportFolders(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	srcFile := fp.Join(t.TempDir(), "import.html")
+	src := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+	<DT><H3>Dev</H3>
+	<DL><p>
+		<DT><H3>Go Lang</H3>
+		<DL><p>
+			<DT><H3>Testing</H3>
+			<DL><p>
+				<DT><A HREF="https://example.com/folders/1" LAST_MODIFIED="1600000000">Testing</A>
+			</DL><p>
+			<DT><A HREF="https://example.com/folders/2" TAGS="tutorial">Go</A>
+		</DL><p>
+	</DL><p>
+	<DT><A HREF="https://example.com/folders/3">Top</A>
+</DL><p>`
+	if err := ioutil.WriteFile(srcFile, []byte(src), 0644); err != nil {
+		t.Fatalf("failed to write import file: %v", err)
+	}
+
+	if err := importBookmarks(srcFile, true, false); err != nil {
+		t.Fatalf("failed to import bookmarks: %v", err)
+	}
+
+	// Each bookmark is tagged with the full chain of its folders
+	bookmarks, err := DB.GetBookmarks(false, db.Page{})
+	if err != nil || len(bookmarks) != 3 {
+		t.Fatalf("expected 3 imported bookmarks, got %d (%v)", len(bookmarks), err)
+	}
+
+	wantTags := []string{"dev/go-lang/testing", "dev/go-lang,tutorial", ""}
+	for i, book := range bookmarks {
+		names := []string{}
+		for _, tag := range book.Tags {
+			names = append(names, tag.Name)
+		}
+		if got := strings.Join(names, ","); got != wantTags[i] {
+			t.Errorf("%s: expected tags %q, got %q", book.Title, wantTags[i], got)
+		}
+	}
+
+	// Exported file nests the bookmarks in the same folders
+	dstFile := fp.Join(t.TempDir(), "export.html")
+	if err = exportBookmarks(dstFile); err != nil {
+		t.Fatalf("failed to export bookmarks: %v", err)
+	}
+
+	dst, err := ioutil.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("failed to read export file: %v", err)
+	}
+
+	want := `<DL><p>` +
+		`<DT><H3>dev</H3><DL><p>` +
+		`<DT><H3>go-lang</H3><DL><p>` +
+		`<DT><H3>testing</H3><DL><p><DT><A HREF="https://example.com/folders/1"`
+	if got := string(dst); !strings.Contains(got, want) ||
+		!strings.Contains(got, `</DL><p><DT><A HREF="https://example.com/folders/2"`) ||
+		!strings.Contains(got, `</DL><p></DL><p><DT><A HREF="https://example.com/folders/3"`) {
+		t.Errorf("unexpected nested folders in exported file: %s", got)
+	}
+}
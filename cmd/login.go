@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/s-frostick/shiori/model"
+	"github.com/sirupsen/logrus"
+)
+
+// Limits of failed logins. Once a username or an address fails too many times
+// within loginWindow, every login from it is refused until the lockout ends.
+const (
+	loginWindow         = 15 * time.Minute
+	loginLockout        = 15 * time.Minute
+	maxUsernameFailures = 5
+	maxAddressFailures  = 20
+)
+
+// dummyPasswordHash is compared with the submitted password when the account doesn't exist,
+// so failed login takes as long whether the username exists or not.
+const dummyPasswordHash = "$2a$10$9Wz0Jes2stVQDgRxw.i3J.yxJQugpNpgp6Ru9D5MjI5JmWPex5F4C"
+
+// Events recorded in audit log of logins.
+const (
+	authEventSuccess = "success"
+	authEventFailure = "failure"
+	authEventLockout = "lockout"
+)
+
+// loginAttempts limits the failed logins of the running server.
+var loginAttempts = newLoginLimiter()
+
+// loginFailures is the failed logins of a username or an address.
+type loginFailures struct {
+	count       int
+	since       time.Time
+	lockedUntil time.Time
+}
+
+// loginLimiter counts failed logins in memory, so it's reset when server restarts.
+type loginLimiter struct {
+	sync.Mutex
+	failures map[string]*loginFailures
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{failures: map[string]*loginFailures{}}
+}
+
+// usernameKey and addressKey separate the failures of username and address,
+// since they are limited differently.
+func usernameKey(username string) string {
+	return "username:" + strings.ToLower(username)
+}
+
+func addressKey(address string) string {
+	return "address:" + address
+}
+
+// lockedUntil returns the time when the lockout of keys ends,
+// or zero time if none of them is locked out.
+func (l *loginLimiter) lockedUntil(now time.Time, keys ...string) time.Time {
+	l.Lock()
+	defer l.Unlock()
+
+	until := time.Time{}
+	for _, key := range keys {
+		if f, ok := l.failures[key]; ok && f.lockedUntil.After(now) && f.lockedUntil.After(until) {
+			until = f.lockedUntil
+		}
+	}
+
+	return until
+}
+
+// fail records failed login of key. Returns true if the failure locks the key out.
+func (l *loginLimiter) fail(now time.Time, key string, maxFailures int) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	// Forget the failures that are too old to matter
+	for k, f := range l.failures {
+		if now.Sub(f.since) > loginWindow && !f.lockedUntil.After(now) {
+			delete(l.failures, k)
+		}
+	}
+
+	f, ok := l.failures[key]
+	if !ok {
+		f = &loginFailures{since: now}
+		l.failures[key] = f
+	}
+
+	f.count++
+	if f.count < maxFailures {
+		return false
+	}
+
+	// Start counting again once the lockout ends
+	f.count, f.since, f.lockedUntil = 0, now.Add(loginLockout), now.Add(loginLockout)
+	return true
+}
+
+// reset forgets the failures of key, e.g. after successful login.
+func (l *loginLimiter) reset(key string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.failures, key)
+}
+
+// clientAddress returns IP address of the client that sent the request,
+// which may be forwarded by reverse proxy.
+func clientAddress(r *http.Request) string {
+	if address := forwardedAddress(r); address != "" {
+		return address
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// recordAuthEvent saves the login attempt into audit log. Failing to save it
+// is only logged, so the audit log never prevents anyone from logging in.
+func recordAuthEvent(event, username, address, message string) {
+	err := DB.CreateAuthEvent(model.AuthEvent{
+		Event:    event,
+		Username: username,
+		Address:  address,
+		Message:  message,
+		Created:  time.Now().UTC().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		logrus.Errorln("Failed to save audit log:", err)
+	}
+}
+
+// retryAfter returns the seconds until the time, to be sent in Retry-After header.
+func retryAfter(now, until time.Time) string {
+	return fmt.Sprintf("%d", int(until.Sub(now).Seconds()+0.5))
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	db "github.com/s-frostick/shiori/database"
+)
+
+func TestLoginLockout(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	loginAttempts = newLoginLimiter()
+	defer func() { loginAttempts = newLoginLimiter() }()
+
+	for _, username := range []string{"alice", "bob"} {
+		if err := addAccount(username, "fooBar123", ""); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+	}
+
+	// Audit log isn't cleared between tests, so only the new events are checked
+	lastEventID := int64(0)
+	if events, err := DB.GetAuthEvents("", db.Page{Limit: 1}); err == nil && len(events) > 0 {
+		lastEventID = events[0].ID
+	}
+
+	jwtKey = []byte("test-key")
+	login := func(username, password, address string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, username, password)
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader(body))
+		r.RemoteAddr = address + ":1234"
+		w := httptest.NewRecorder()
+		apiLogin(w, r, nil)
+		return w
+	}
+
+	// Missing account and wrong password fail with the same message
+	missing, wrong := login("nobody", "fooBar123", "192.0.2.1"), login("alice", "wrong", "192.0.2.1")
+	if missing.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized || missing.Body.String() != wrong.Body.String() {
+		t.Errorf("expected the same failure, got %d (%s) and %d (%s)", missing.Code, missing.Body, wrong.Code, wrong.Body)
+	}
+
+	// Successful login forgets the failures of username
+	for i := 0; i < maxUsernameFailures-2; i++ {
+		login("alice", "wrong", "192.0.2.1")
+	}
+	if w := login("alice", "fooBar123", "192.0.2.1"); w.Code != http.StatusOK {
+		t.Fatalf("expected login to succeed, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Too many failures lock the username out, even with the right password
+	for i := 0; i < maxUsernameFailures; i++ {
+		login("alice", "wrong", "192.0.2.2")
+	}
+	w := login("alice", "fooBar123", "192.0.2.3")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected locked out username, got %d (%s)", w.Code, w.Body)
+	}
+	if w = login("bob", "fooBar123", "192.0.2.3"); w.Code != http.StatusOK {
+		t.Errorf("expected other username to log in, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Too many failures from the same address lock it out for every username
+	for i := 0; i < maxAddressFailures; i++ {
+		login(fmt.Sprintf("user%d", i), "wrong", "192.0.2.4")
+	}
+	if w = login("bob", "fooBar123", "192.0.2.4"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected locked out address, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Lockout ends after a while
+	later := time.Now().Add(loginLockout + time.Minute)
+	if until := loginAttempts.lockedUntil(later, usernameKey("alice"), addressKey("192.0.2.4")); !until.IsZero() {
+		t.Errorf("expected lockout to end, got %v", until)
+	}
+
+	// Every attempt is recorded in audit log
+	events, err := DB.GetAuthEvents("alice", db.Page{})
+	if err != nil {
+		t.Fatalf("failed to get audit log: %v", err)
+	}
+
+	count := map[string]int{}
+	for _, event := range events {
+		if event.ID > lastEventID {
+			count[event.Event]++
+		}
+	}
+	wantFailures := 1 + (maxUsernameFailures - 2) + maxUsernameFailures + 1
+	if count[authEventSuccess] != 1 || count[authEventFailure] != wantFailures || count[authEventLockout] != 1 {
+		t.Errorf("unexpected audit log of alice: %v", count)
+	}
+	if events[0].Message != "Refused while locked out" || events[0].Address != "192.0.2.3" {
+		t.Errorf("expected the newest event first, got %+v", events[0])
+	}
+
+	page, _ := db.NewPage(2, 1)
+	b := bytes.NewBufferString("")
+	if err = printAuthEvents("", page, b); err != nil || strings.Count(b.String(), "\n") != 2 {
+		t.Errorf("expected 2 printed events, got %q (%v)", b.String(), err)
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the database schema version",
+		Long: "Manage the database schema version. " +
+			"Every command applies pending migrations automatically, " +
+			"use this command to check or upgrade the database explicitly.",
+		// Skip the automatic migration from root command,
+		// so status is able to report the pending migrations.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			openCommandDatabase(cmd)
+		},
+	}
+
+	migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Print the applied and pending migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := printMigrationStatus(os.Stdout)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+
+	migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := migrateUp(os.Stdout)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+)
+
+func init() {
+	migrateCmd.AddCommand(migrateStatusCmd)
+	migrateCmd.AddCommand(migrateUpCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func printMigrationStatus(wr io.Writer) error {
+	version, err := DB.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(wr, "Schema version: %d\n", version)
+	for _, m := range DB.Migrations() {
+		status := "pending"
+		if m.Version <= version {
+			status = "applied"
+		}
+
+		cIndex.Fprintf(wr, "%3d. ", m.Version)
+		fmt.Fprintf(wr, "%-8s %s\n", status, m.Description)
+	}
+
+	return nil
+}
+
+func migrateUp(wr io.Writer) error {
+	applied, err := DB.Migrate()
+	for _, m := range applied {
+		cIndex.Fprintf(wr, "%3d. ", m.Version)
+		fmt.Fprintln(wr, m.Description)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(wr, "Database is already up to date")
+	}
+
+	return nil
+}
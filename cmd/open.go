@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/s-frostick/shiori/database"
 	"github.com/spf13/cobra"
 )
 
@@ -51,7 +52,7 @@ func init() {
 
 func openBookmarks(args ...string) {
 	// Read bookmarks from database
-	bookmarks, err := DB.GetBookmarks(false, args...)
+	bookmarks, err := DB.GetBookmarks(false, database.Page{}, args...)
 	if err != nil {
 		cError.Println(err)
 		return
@@ -77,7 +78,7 @@ func openBookmarks(args ...string) {
 
 func openBookmarksCache(trimSpace bool, args ...string) {
 	// Read bookmark content from database
-	bookmarks, err := DB.GetBookmarks(true, args...)
+	bookmarks, err := DB.GetBookmarks(true, database.Page{}, args...)
 	if err != nil {
 		cError.Println(err)
 		return
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"strings"
 
 	"github.com/s-frostick/shiori/model"
@@ -15,22 +16,31 @@ var (
 		Short: "Print the saved bookmarks",
 		Long: "Show the saved bookmarks by its DB index. " +
 			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
-			"If no arguments, all records with actual index from DB are shown.",
+			"If no arguments, all records with actual index from DB are shown. " +
+			"Use --limit and --page flags to print the bookmarks page by page.",
 		Aliases: []string{"list", "ls"},
 		Run: func(cmd *cobra.Command, args []string) {
 			// Read flags
 			useJSON, _ := cmd.Flags().GetBool("json")
 			indexOnly, _ := cmd.Flags().GetBool("index-only")
 
+			page, err := pageFromFlags(cmd)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
 			// Read bookmarks from database
-			bookmarks, err := DB.GetBookmarks(false, args...)
+			bookmarks, err := DB.GetBookmarks(false, page, args...)
 			if err != nil {
 				cError.Println(err)
 				return
 			}
 
 			if len(bookmarks) == 0 {
-				if len(args) > 0 {
+				if page.Offset > 0 {
+					cError.Println("No bookmarks in this page")
+				} else if len(args) > 0 {
 					cError.Println("No matching index found")
 				} else {
 					cError.Println("No bookmarks saved yet")
@@ -59,6 +69,8 @@ var (
 func init() {
 	printCmd.Flags().BoolP("json", "j", false, "Output data in JSON format")
 	printCmd.Flags().BoolP("index-only", "i", false, "Only print the index of bookmarks")
+	printCmd.Flags().IntP("limit", "l", 0, "Maximum number of bookmarks to print, 0 means no limit")
+	printCmd.Flags().IntP("page", "p", 1, "Page of bookmarks to print, used together with --limit")
 	rootCmd.AddCommand(printCmd)
 }
 
@@ -100,6 +112,18 @@ func printBookmark(bookmarks ...model.Bookmark) {
 			cExcerpt.Println(bookmark.Excerpt)
 		}
 
+		// Print matching snippet from search
+		if bookmark.Snippet != "" {
+			cSymbol.Print(strSpace + "~ ")
+			printSnippet(bookmark.Snippet)
+		}
+
+		// Print deletion time of bookmark in trash
+		if bookmark.Deleted != "" {
+			cSymbol.Print(strSpace + "x ")
+			cError.Println("Deleted at " + bookmark.Deleted)
+		}
+
 		// Print bookmark tags
 		if len(bookmark.Tags) > 0 {
 			cSymbol.Print(strSpace + "# ")
@@ -116,3 +140,21 @@ func printBookmark(bookmarks ...model.Bookmark) {
 		fmt.Println()
 	}
 }
+
+// printSnippet prints the snippet from search result,
+// with the terms inside <mark> highlighted.
+func printSnippet(snippet string) {
+	for i, part := range strings.Split(snippet, "<mark>") {
+		if i == 0 {
+			cExcerpt.Print(html.UnescapeString(part))
+			continue
+		}
+
+		marked := strings.SplitN(part, "</mark>", 2)
+		cMatch.Print(html.UnescapeString(marked[0]))
+		if len(marked) == 2 {
+			cExcerpt.Print(html.UnescapeString(marked[1]))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// basePath is the path prefix of every route, e.g. /shiori, so shiori can be
+	// served under sub-path of reverse proxy. Empty when served from root.
+	basePath string
+
+	// trustProxy allows X-Forwarded-* headers of reverse proxy to tell the address
+	// of client, the scheme and the path prefix removed by proxy. Only enable it
+	// behind a proxy that sets these headers, since clients can send them too.
+	trustProxy bool
+)
+
+// normalizeBasePath converts base path into the form used in basePath,
+// i.e. with leading slash and without trailing slash.
+func normalizeBasePath(path string) (string, error) {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return "", nil
+	}
+
+	path = "/" + path
+	if !isSafeBasePath(path) {
+		return "", fmt.Errorf("Base path %q is not valid", path)
+	}
+
+	return path, nil
+}
+
+// isSafeBasePath checks if path can be put in redirect and page as path prefix,
+// without pointing to other site or breaking out of HTML attribute.
+func isSafeBasePath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") &&
+		!strings.ContainsAny(path, "\\?#\"'<>` \t\r\n")
+}
+
+// publicBasePath returns the base path of shiori as seen by browser, which also
+// includes the prefix that reverse proxy removed and sent in X-Forwarded-Prefix.
+func publicBasePath(r *http.Request) string {
+	if !trustProxy {
+		return basePath
+	}
+
+	prefix := strings.TrimRight(r.Header.Get("X-Forwarded-Prefix"), "/")
+	if prefix == "" || !isSafeBasePath(prefix) {
+		return basePath
+	}
+
+	return prefix + basePath
+}
+
+// isSecureRequest checks if browser sent the request with HTTPS, either directly
+// or to reverse proxy that reports it in X-Forwarded-Proto.
+func isSecureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	return trustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// forwardedAddress returns the client address that reverse proxy sent in X-Forwarded-For.
+// The last address is used, since it's added by the proxy itself while the others
+// come from the client, which can send anything.
+func forwardedAddress(r *http.Request) string {
+	if !trustProxy {
+		return ""
+	}
+
+	addresses := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	address := strings.TrimSpace(addresses[len(addresses)-1])
+	if net.ParseIP(address) == nil {
+		return ""
+	}
+
+	return address
+}
+
+// withBasePath serves handler under basePath. Request for the base path itself is
+// redirected to the path with trailing slash, so relative URLs in pages work.
+func withBasePath(handler http.Handler) http.Handler {
+	if basePath == "" {
+		return handler
+	}
+
+	stripped := http.StripPrefix(basePath, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == basePath:
+			http.Redirect(w, r, publicBasePath(r)+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, basePath+"/"):
+			stripped.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
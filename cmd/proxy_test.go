@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"/", "", false},
+		{"shiori", "/shiori", false},
+		{"/shiori/", "/shiori", false},
+		{"/apps/shiori", "/apps/shiori", false},
+		{"//evil.example", "/evil.example", false},
+		{"/shiori?a=b", "", true},
+		{`/shiori"><script>`, "", true},
+	} {
+		path, err := normalizeBasePath(tt.path)
+		if path != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%q: expected %q (error %v), got %q (%v)", tt.path, tt.want, tt.wantErr, path, err)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	basePath, trustProxy = "/shiori", false
+	defer func() { basePath, trustProxy = "", false }()
+
+	router := httprouter.New()
+	router.GET("/", serveIndexPage)
+	router.GET("/login", serveLoginPage)
+	handler := withBasePath(router)
+
+	request := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Routes are served under base path, and redirect within it
+	for _, tt := range []struct {
+		path         string
+		headers      map[string]string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"/shiori", nil, http.StatusMovedPermanently, "/shiori/"},
+		{"/shiori/", nil, http.StatusMovedPermanently, "/shiori/login"},
+		{"/shiori/login", nil, http.StatusOK, ""},
+		{"/login", nil, http.StatusNotFound, ""},
+		{"/shiorix/login", nil, http.StatusNotFound, ""},
+		{"/shiori/", map[string]string{"X-Forwarded-Prefix": "/proxy"}, http.StatusMovedPermanently, "/shiori/login"},
+	} {
+		w := request(tt.path, tt.headers)
+		if w.Code != tt.wantStatus || w.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.wantStatus, tt.wantLocation, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	if body := request("/shiori/login", nil).Body.String(); !strings.Contains(body, `<base href="/shiori/">`) {
+		t.Errorf("expected base URL of page to be the base path, got %q", body)
+	}
+
+	// Prefix removed by trusted proxy is put back
+	trustProxy = true
+	forwarded := map[string]string{"X-Forwarded-Prefix": "/proxy/"}
+	if w := request("/shiori/", forwarded); w.Header().Get("Location") != "/proxy/shiori/login" {
+		t.Errorf("expected redirect with forwarded prefix, got %q", w.Header().Get("Location"))
+	}
+	if body := request("/shiori/login", forwarded).Body.String(); !strings.Contains(body, `<base href="/proxy/shiori/">`) {
+		t.Errorf("expected base URL of page to include forwarded prefix, got %q", body)
+	}
+
+	unsafe := map[string]string{"X-Forwarded-Prefix": "//evil.example"}
+	if w := request("/shiori/", unsafe); w.Header().Get("Location") != "/shiori/login" {
+		t.Errorf("expected unsafe prefix to be ignored, got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	defer func() { basePath, trustProxy = "", false }()
+
+	r := httptest.NewRequest("GET", "/api/bookmarks", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Prefix", "/proxy")
+
+	// Headers are ignored unless proxy is trusted, since anyone can send them
+	basePath, trustProxy = "/shiori", false
+	cookie := tokenCookie(r, "token", time.Now())
+	if address := clientAddress(r); address != "10.0.0.2" {
+		t.Errorf("expected address of connection, got %s", address)
+	}
+	if cookie.Secure || cookie.Path != "/shiori/" {
+		t.Errorf("expected insecure cookie in base path, got %+v", cookie)
+	}
+
+	// Address added by the proxy itself is used
+	trustProxy = true
+	cookie = tokenCookie(r, "token", time.Now())
+	if address := clientAddress(r); address != "198.51.100.7" {
+		t.Errorf("expected forwarded address, got %s", address)
+	}
+	if !cookie.Secure || cookie.Path != "/proxy/shiori/" {
+		t.Errorf("expected secure cookie in forwarded path, got %+v", cookie)
+	}
+
+	r.Header.Set("X-Forwarded-For", "not an address")
+	if address := clientAddress(r); address != "10.0.0.2" {
+		t.Errorf("expected invalid forwarded address to be ignored, got %s", address)
+	}
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
 	"github.com/spf13/cobra"
 )
 
@@ -11,12 +13,116 @@ var (
 	// DB is database that used by this cli
 	DB database.Database
 
+	// OpenDatabase opens the database of the chosen DBMS, which is empty when not chosen.
+	// It's used to open DB before running command, unless DB is already set.
+	OpenDatabase func(dbms string) (database.Database, error)
+
 	rootCmd = &cobra.Command{
 		Use:   "shiori",
 		Short: "Simple command-line bookmark manager built with Go",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			openCommandDatabase(cmd)
+
+			// Make sure database schema is up to date before running any command
+			_, err := DB.Migrate()
+			if err != nil {
+				cError.Println("Failed to upgrade database:", err)
+				os.Exit(1)
+			}
+
+			// Remove bookmarks that stay in trash longer than retention period
+			retention, err := trashRetention()
+			if err != nil {
+				cError.Println(err)
+				os.Exit(1)
+			}
+
+			if _, err = purgeExpiredTrash(retention); err != nil {
+				cError.Println("Failed to purge trash:", err)
+			}
+
+			// Act as the chosen account, so only its bookmarks and tags are accessible
+			username, _ := cmd.Flags().GetString("user")
+			if username == "" {
+				username = os.Getenv("ENV_SHIORI_USER")
+			}
+
+			account, err := commandAccount(username, cmd.Annotations[annotationNeedsAccount] != "")
+			if err != nil {
+				cError.Println(err)
+				os.Exit(1)
+			}
+
+			if account.ID != 0 {
+				DB = DB.ForAccount(account.ID)
+			}
+		},
 	}
 )
 
+// annotationNeedsAccount marks the command that must act as a single account, i.e. the one
+// that saves new bookmarks, which must be owned by an account to be seen after logging in,
+// and the one that changes tags by name, which may be used by several accounts.
+const annotationNeedsAccount = "needsAccount"
+
+func init() {
+	rootCmd.PersistentFlags().String("dbms", "", "Database to use, either sqlite, mysql or postgresql. Defaults to sqlite. "+
+		"Can also be set with ENV_SHIORI_DBMS")
+	rootCmd.PersistentFlags().String("user", "", "Manage bookmarks and tags of this account instead of every account. "+
+		"Required by commands that save new bookmarks or change tags when there are several accounts. "+
+		"Can also be set with ENV_SHIORI_USER")
+}
+
+// openCommandDatabase opens DB using the DBMS chosen with flag or environment variable,
+// unless it's already opened. Command can't run without database, so failure exits.
+func openCommandDatabase(cmd *cobra.Command) {
+	if DB != nil {
+		return
+	}
+
+	dbms, _ := cmd.Flags().GetString("dbms")
+	if dbms == "" {
+		dbms = os.Getenv("ENV_SHIORI_DBMS")
+	}
+
+	db, err := OpenDatabase(dbms)
+	if err != nil {
+		cError.Println("Failed to open database:", err)
+		os.Exit(1)
+	}
+
+	DB = db
+}
+
+// commandAccount returns the account that the command acts as, or zero account
+// when it's not limited to any account. Without username, command that needs account
+// acts as the only account, and refuses to guess when there are several. When there's
+// no account yet, new bookmarks are taken by the first account created.
+func commandAccount(username string, needsAccount bool) (model.Account, error) {
+	if username != "" {
+		return findAccount(username)
+	}
+
+	if !needsAccount {
+		return model.Account{}, nil
+	}
+
+	accounts, err := DB.GetAccounts("", false)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	switch len(accounts) {
+	case 0:
+		return model.Account{}, nil
+	case 1:
+		return accounts[0], nil
+	default:
+		return model.Account{}, database.NewError(database.ErrValidation,
+			"There are several accounts, choose the one to act as with --user or ENV_SHIORI_USER")
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
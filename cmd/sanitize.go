@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	nurl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cacheContentPolicy is Content-Security-Policy of cached pages. Scripts can only
+// come from shiori itself, so anything that slipped through sanitizing can't run.
+const cacheContentPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"img-src * data:; media-src *; font-src 'self'; " +
+	"base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// allowedElements is the allow-list of elements in archived HTML, with the attributes
+// allowed in each of them. Elements that aren't listed are removed, but their content is kept.
+var allowedElements = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.Article:    nil,
+	atom.Aside:      nil,
+	atom.Audio:      {"src", "controls"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Col:        {"span"},
+	atom.Colgroup:   {"span"},
+	atom.Dd:         nil,
+	atom.Del:        nil,
+	atom.Details:    nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.Footer:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Header:     nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        nil,
+	atom.Kbd:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start"},
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Section:    nil,
+	atom.Small:      nil,
+	atom.Source:     {"src", "type"},
+	atom.Span:       nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan", "scope"},
+	atom.Thead:      nil,
+	atom.Time:       {"datetime"},
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+	atom.Video:      {"src", "poster", "controls", "width", "height"},
+}
+
+// droppedElements are removed together with their content, since their content
+// is either code or makes no sense without the element.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Applet:   true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Form:     true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Button:   true,
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Meta:     true,
+	atom.Link:     true,
+	atom.Base:     true,
+}
+
+// urlAttributes are the attributes that hold URL, which must be safe to follow.
+var urlAttributes = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"poster": true,
+	"cite":   true,
+}
+
+// sanitizeHTML removes anything that can run script from archived HTML,
+// e.g. script, event handlers, iframe and javascript URL. It keeps only
+// the elements and attributes in allow-list, so unknown tricks are removed too.
+func sanitizeHTML(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), context)
+	if err != nil {
+		// Parser only fails when reading fails, which never happens with string,
+		// but just in case, nothing is safer than escaped HTML
+		return html.EscapeString(s)
+	}
+
+	sb := strings.Builder{}
+	for _, node := range nodes {
+		writeSanitizedNode(&sb, node)
+	}
+
+	return sb.String()
+}
+
+func writeSanitizedNode(sb *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		sb.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		// Comments and doctypes are removed
+		return
+	}
+
+	if droppedElements[node.DataAtom] {
+		return
+	}
+
+	allowedAttrs, allowed := allowedElements[node.DataAtom]
+	if node.Namespace == "" && allowed {
+		sb.WriteString("<" + node.Data)
+		for _, attr := range node.Attr {
+			if attr.Namespace != "" || !containsString(allowedAttrs, attr.Key) {
+				continue
+			}
+
+			if urlAttributes[attr.Key] && !isSafeURL(node.DataAtom, attr.Val) {
+				continue
+			}
+
+			sb.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+		}
+		sb.WriteString(">")
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeSanitizedNode(sb, child)
+	}
+
+	if node.Namespace == "" && allowed && !isVoidElement(node.DataAtom) {
+		sb.WriteString("</" + node.Data + ">")
+	}
+}
+
+// isSafeURL checks if URL is relative or uses a scheme that can't run script.
+// Image may also be embedded as data URL, since image never runs script.
+func isSafeURL(element atom.Atom, url string) bool {
+	parsedURL, err := nurl.Parse(strings.TrimSpace(url))
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(parsedURL.Scheme) {
+	case "", "http", "https":
+		return true
+	case "mailto":
+		return element == atom.A
+	case "data":
+		return element == atom.Img && strings.HasPrefix(strings.ToLower(parsedURL.Opaque), "image/")
+	default:
+		return false
+	}
+}
+
+// isVoidElement checks if element has no content and no end tag.
+func isVoidElement(element atom.Atom) bool {
+	switch element {
+	case atom.Br, atom.Col, atom.Hr, atom.Img, atom.Source:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
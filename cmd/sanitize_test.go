@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	db "github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+)
+
+// maliciousHTML are archived pages that try to run script, with the parts
+// that must never survive sanitizing.
+var maliciousHTML = []struct {
+	name      string
+	html      string
+	forbidden []string
+}{
+	{"script", `<p>Hello</p><script>alert(document.cookie)</script>`, []string{"<script", "alert"}},
+	{"uppercase script", `<SCRIPT SRC=//evil.example/x.js></SCRIPT>`, []string{"script", "evil"}},
+	{"event handler", `<img src="x.png" onerror="alert(1)">`, []string{"onerror", "alert"}},
+	{"event handler without quotes", `<p onmouseover=alert(1)>Hover</p>`, []string{"onmouseover", "alert"}},
+	{"javascript URL", `<a href="javascript:alert(1)">Click</a>`, []string{"javascript", "alert"}},
+	{"encoded javascript URL", `<a href="&#106;ava&#x73;cript&colon;alert(1)">Click</a>`, []string{"cript", "alert"}},
+	{"javascript URL with whitespace", `<a href=" java	script:alert(1)">Click</a>`, []string{"cript", "alert"}},
+	{"data URL in link", `<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">Click</a>`, []string{"data:"}},
+	{"iframe", `<iframe src="https://evil.example"></iframe>`, []string{"iframe", "evil"}},
+	{"object and embed", `<object data="x.swf"><embed src="x.swf"></object>`, []string{"object", "embed", "swf"}},
+	{"svg onload", `<svg onload="alert(1)"><script>alert(2)</script></svg>`, []string{"svg", "onload", "alert"}},
+	{"style", `<style>body{background:url(javascript:alert(1))}</style><p style="color:red">Red</p>`, []string{"style", "alert"}},
+	{"base and meta", `<base href="https://evil.example/"><meta http-equiv="refresh" content="0;url=https://evil.example">`, []string{"base", "meta", "evil"}},
+	{"form", `<form action="https://evil.example"><input name="password"><button>Send</button></form>`, []string{"form", "input", "evil"}},
+	{"noscript mutation", `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`, []string{"onerror", "alert"}},
+	{"comment", `<!--<script>alert(1)</script>--><p>Text</p>`, []string{"<!--", "alert"}},
+	{"unclosed tag", `<p>Text<img src=x onerror=alert(1)`, []string{"onerror", "alert"}},
+	{"attribute breakout", `<img alt='"><script>alert(1)</script>' src="x.png">`, []string{"<script", "\"><"}},
+	{"id clobbering", `<div id="cache-page" class="dark-mode">Text</div>`, []string{"cache-page", "dark-mode"}},
+	{"video event handler", `<video src="v.mp4" onplay="alert(1)" poster="javascript:alert(2)"></video>`, []string{"onplay", "alert"}},
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	for _, tt := range maliciousHTML {
+		result := sanitizeHTML(tt.html)
+		for _, forbidden := range tt.forbidden {
+			if strings.Contains(strings.ToLower(result), strings.ToLower(forbidden)) {
+				t.Errorf("%s: expected %q to be removed, got %q", tt.name, forbidden, result)
+			}
+		}
+	}
+
+	// Readable content survives sanitizing
+	for _, tt := range []struct {
+		html string
+		want string
+	}{
+		{`<p>Hello <b>world</b></p>`, `<p>Hello <b>world</b></p>`},
+		{`<a href="https://example.com/a?b=1&amp;c=2" title="Example">Link</a>`, `<a href="https://example.com/a?b=1&amp;c=2" title="Example">Link</a>`},
+		{`<img src="/images/a.png" alt="A &lt;b&gt;">`, `<img src="/images/a.png" alt="A &lt;b&gt;">`},
+		{`<img src="data:image/png;base64,iVBORw0KGgo=">`, `<img src="data:image/png;base64,iVBORw0KGgo=">`},
+		{`<table><tr><td colspan="2">Cell</td></tr></table>`, `<table><tbody><tr><td colspan="2">Cell</td></tr></tbody></table>`},
+		{`<custom-element><em>Kept</em></custom-element>`, `<em>Kept</em>`},
+		{`1 < 2 & 3 > 2`, `1 &lt; 2 &amp; 3 &gt; 2`},
+		{`<video controls><source src="../videos/a.mp4" type="video/mp4">No video.</video>`,
+			`<video controls=""><source src="../videos/a.mp4" type="video/mp4">No video.</video>`},
+	} {
+		if result := sanitizeHTML(tt.html); result != tt.want {
+			t.Errorf("expected %q to be kept as %q, got %q", tt.html, tt.want, result)
+		}
+	}
+
+	// Sanitizing is stable, so sanitizing at save and at render time gives the same page
+	for _, tt := range maliciousHTML {
+		once := sanitizeHTML(tt.html)
+		if twice := sanitizeHTML(once); twice != once {
+			t.Errorf("%s: expected sanitizing twice to change nothing, got %q and %q", tt.name, once, twice)
+		}
+	}
+}
+
+func TestCacheSanitized(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	tplCache = template.Must(template.New("cache.html").Funcs(cacheFuncMap).Parse(`{{html .HTML}}`))
+
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+	account, _ := findAccount("alice")
+	token := signTestToken(t, account.ID)
+
+	// Archived HTML is sanitized when saved
+	malicious := `<p>Article</p><script>alert(1)</script><img src="x.png" onerror="alert(2)">`
+	book, err := addBookmark(DB.ForAccount(account.ID), model.Bookmark{URL: "https://example.com/malicious", Title: "Malicious", HTML: malicious}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+
+	saved, err := DB.GetBookmarks(true, db.Page{}, strconv.FormatInt(book.ID, 10))
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("failed to read testing bookmark: %v", err)
+	}
+	if strings.Contains(saved[0].HTML, "alert") || !strings.Contains(saved[0].HTML, "<p>Article</p>") {
+		t.Errorf("expected sanitized HTML to be saved, got %q", saved[0].HTML)
+	}
+
+	// Bookmark saved before sanitizing existed is sanitized when rendered
+	saved[0].HTML = malicious
+	if _, err = DB.UpdateBookmarks(saved); err != nil {
+		t.Fatalf("failed to update testing bookmark: %v", err)
+	}
+
+	id := strconv.FormatInt(book.ID, 10)
+	r := httptest.NewRequest("GET", "/bookmark/"+id, nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	serveBookmarkCache(w, r, httprouter.Params{{Key: "id", Value: id}})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusOK, w.Code, w.Body)
+	}
+	if body := w.Body.String(); strings.Contains(body, "alert") || !strings.Contains(body, "<p>Article</p>") {
+		t.Errorf("expected sanitized HTML to be rendered, got %q", body)
+	}
+
+	csp := w.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "default-src 'none'") || !strings.Contains(csp, "script-src 'self'") || strings.Contains(csp, "unsafe-inline") {
+		t.Errorf("expected strict Content-Security-Policy, got %q", csp)
+	}
+}
@@ -3,34 +3,60 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/s-frostick/shiori/database"
 	"github.com/spf13/cobra"
 )
 
 var (
 	searchCmd = &cobra.Command{
-		Use:   "search keyword",
-		Short: "Search bookmarks by submitted keyword",
-		Long: "Search bookmarks by looking for matching keyword in bookmark's title and content. " +
-			"If no keyword submitted, print all saved bookmarks. " +
+		Use:   "search [query]",
+		Short: "Search bookmarks by submitted query",
+		Long: "Search bookmarks by looking for matching query in bookmark's url, title and content. " +
+			"If no query submitted, print all saved bookmarks. " +
+			"Words are combined with AND by default, \"exact phrase\" searches the whole phrase, " +
+			"OR matches either side, NOT or - excludes the next term, and parentheses group the terms. " +
+			"The query also accepts these filters :\n" +
+			"- tag:name or #name, bookmarks with the tag.\n" +
+			"- site:domain, bookmarks from the domain or its subdomains.\n" +
+			"- after:YYYY-MM-DD and before:YYYY-MM-DD, bookmarks modified since or before the date.\n" +
+			"- is:video, bookmarks of a video.\n" +
+			"For example : shiori search 'tag:go -tag:old site:github.com after:2024-01-01 \"exact phrase\"'\n" +
+			"The results can be sorted by relevance (default), newest, oldest or title using --sort flag, " +
+			"and printed page by page using --limit and --page flags. " +
 			"Search results will be different depending on DBMS that used by shiori :\n" +
-			"- sqlite3, search works using fts4 method: https://www.sqlite.org/fts3.html.\n" +
-			"- mysql or mariadb, search works using natural language mode: https://dev.mysql.com/doc/refman/5.5/en/fulltext-natural-language.html.",
-		Args: cobra.MaximumNArgs(1),
+			"- sqlite3, search works using fts5 method and bm25 ranking: https://www.sqlite.org/fts5.html.\n" +
+			"- mysql or mariadb, search works using boolean mode: https://dev.mysql.com/doc/refman/5.5/en/fulltext-boolean.html.\n" +
+			"- postgresql, search works using tsvector: https://www.postgresql.org/docs/current/textsearch-controls.html.",
 		Run: func(cmd *cobra.Command, args []string) {
 			// Read flags
 			tags, _ := cmd.Flags().GetStringSlice("tags")
 			useJSON, _ := cmd.Flags().GetBool("json")
 			indexOnly, _ := cmd.Flags().GetBool("index-only")
+			strSort, _ := cmd.Flags().GetString("sort")
 
-			// Fetch keyword
-			keyword := ""
-			if len(args) > 0 {
-				keyword = args[0]
+			order, err := database.ParseSortOrder(strSort)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			page, err := pageFromFlags(cmd)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			// Parse query
+			query, err := database.ParseQuery(strings.Join(args, " "))
+			if err != nil {
+				cError.Println(err)
+				return
 			}
 
 			// Read bookmarks from database
-			bookmarks, err := DB.SearchBookmarks(false, keyword, tags...)
+			bookmarks, _, err := DB.SearchBookmarks(order, page, query.WithTags(tags...))
 			if err != nil {
 				cError.Println(err)
 				return
@@ -62,5 +88,8 @@ func init() {
 	searchCmd.Flags().BoolP("json", "j", false, "Output data in JSON format")
 	searchCmd.Flags().BoolP("index-only", "i", false, "Only print the index of bookmarks")
 	searchCmd.Flags().StringSliceP("tags", "t", []string{}, "Search bookmarks with specified tag(s)")
+	searchCmd.Flags().StringP("sort", "s", "relevance", "Sort the results by relevance, newest, oldest or title")
+	searchCmd.Flags().IntP("limit", "l", 0, "Maximum number of bookmarks to print, 0 means no limit")
+	searchCmd.Flags().IntP("page", "p", 1, "Page of search results to print, used together with --limit")
 	rootCmd.AddCommand(searchCmd)
 }
@@ -2,103 +2,315 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"mime"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	fp "path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/dgrijalva/jwt-go/request"
 	"github.com/julienschmidt/httprouter"
 	"github.com/s-frostick/shiori/assets"
+	"github.com/s-frostick/shiori/database"
 	"github.com/s-frostick/shiori/model"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// defaultPageLimit is the number of bookmarks in a page of API response.
+const defaultPageLimit = 30
+
 var (
+	// errUnauthorized is the kind of error returned when request doesn't have valid credentials.
+	errUnauthorized = errors.New("Unauthorized")
+
+	// errForbidden is the kind of error returned when the role of account doesn't allow the request.
+	errForbidden = errors.New("Forbidden")
+
+	// errTooManyRequests is the kind of error returned when client is locked out after failed logins.
+	errTooManyRequests = errors.New("Too many requests")
+
 	jwtKey   []byte
 	tplCache *template.Template
+
+	// serverJobs is the work that server waits for when shutting down, i.e. background
+	// jobs and the bookmarks that requests are still fetching or downloading videos for.
+	serverJobs sync.WaitGroup
+
+	// serveFlagEnvs is the environment variables of serve flags, used when the flag isn't specified.
+	serveFlagEnvs = map[string]string{
+		"address":          "ENV_SHIORI_ADDRESS",
+		"port":             "ENV_SHIORI_PORT",
+		"read-timeout":     "ENV_SHIORI_READ_TIMEOUT",
+		"write-timeout":    "ENV_SHIORI_WRITE_TIMEOUT",
+		"idle-timeout":     "ENV_SHIORI_IDLE_TIMEOUT",
+		"shutdown-timeout": "ENV_SHIORI_SHUTDOWN_TIMEOUT",
+		"base-path":        "ENV_SHIORI_BASE_PATH",
+		"trust-proxy":      "ENV_SHIORI_TRUST_PROXY",
+	}
+
+	// cacheFuncMap is the functions used in template of cached page.
+	cacheFuncMap = template.FuncMap{
+		"html": func(s string) template.HTML {
+			// Bookmarks saved by older version might not be sanitized yet
+			return template.HTML(sanitizeHTML(s))
+		},
+	}
+
 	serveCmd = &cobra.Command{
 		Use:   "serve",
 		Short: "Serve web app for managing bookmarks",
 		Long: "Run a simple annd performant web server which serves the site for managing bookmarks." +
 			"If --port flag is not used, it will use port 8080 by default.",
 		Run: func(cmd *cobra.Command, args []string) {
-			// Create JWT key
-			jwtKey = make([]byte, 32)
-			_, err := rand.Read(jwtKey)
+			// Server can also be configured with environment variables, e.g. in Docker container
+			err := setFlagsFromEnv(cmd, serveFlagEnvs)
 			if err != nil {
-				cError.Println("Failed to generate key for token")
+				cError.Println(err)
 				return
 			}
 
-			// Prepare template
-			funcMap := template.FuncMap{
-				"html": func(s string) template.HTML {
-					return template.HTML(s)
-				},
+			// Load JWT key, so tokens stay valid after restarting server
+			keyFile, _ := cmd.Flags().GetString("key-file")
+			jwtKey, err = loadJWTKey(keyFile)
+			if err != nil {
+				cError.Println("Failed to load key for token:", err)
+				return
 			}
 
+			// Use HTTPS if certificate is specified or should be generated
+			tlsCert, _ := cmd.Flags().GetString("tls-cert")
+			tlsKey, _ := cmd.Flags().GetString("tls-key")
+			selfSigned, _ := cmd.Flags().GetBool("self-signed")
+			tlsCert, tlsKey, err = loadTLSFiles(tlsCert, tlsKey, selfSigned)
+			if err != nil {
+				cError.Println("Failed to load TLS certificate:", err)
+				return
+			}
+
+			// Serve under sub-path of reverse proxy if needed
+			basePathFlag, _ := cmd.Flags().GetString("base-path")
+			basePath, err = normalizeBasePath(basePathFlag)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+			trustProxy, _ = cmd.Flags().GetBool("trust-proxy")
+
+			// Prepare template
 			tplFile, _ := assets.ReadFile("cache.html")
-			tplCache, err = template.New("cache.html").Funcs(funcMap).Parse(string(tplFile))
+			tplCache, err = template.New("cache.html").Funcs(cacheFuncMap).Parse(string(tplFile))
 			if err != nil {
 				cError.Println("Failed to generate HTML template")
 				return
 			}
 
-			// Create router
-			router := httprouter.New()
+			router := newRouter()
 
-			router.GET("/js/*filepath", serveFiles)
-			router.GET("/res/*filepath", serveFiles)
-			router.GET("/css/*filepath", serveFiles)
-			router.GET("/webfonts/*filepath", serveFiles)
+			// Remove expired bookmarks from trash while serving
+			jobsCtx, stopJobs := context.WithCancel(context.Background())
+			retention, _ := trashRetention()
+			serverJobs.Add(1)
+			go func() {
+				defer serverJobs.Done()
+				purgeTrashPeriodically(jobsCtx, retention)
+			}()
 
-			router.ServeFiles("/videos/*filepath", http.Dir("videos"))
+			// Serve HTTP, or HTTPS if certificate is used
+			address, _ := cmd.Flags().GetString("address")
+			port, _ := cmd.Flags().GetInt("port")
+			readTimeout, _ := cmd.Flags().GetDuration("read-timeout")
+			writeTimeout, _ := cmd.Flags().GetDuration("write-timeout")
+			idleTimeout, _ := cmd.Flags().GetDuration("idle-timeout")
+			svr := &http.Server{
+				Addr:         net.JoinHostPort(address, strconv.Itoa(port)),
+				Handler:      withBasePath(router),
+				ReadTimeout:  readTimeout,
+				WriteTimeout: writeTimeout,
+				IdleTimeout:  idleTimeout,
+			}
+			servers := []*http.Server{svr}
 
-			router.GET("/", serveIndexPage)
-			router.GET("/login", serveLoginPage)
-			router.GET("/bookmark/:id", serveBookmarkCache)
+			failed := make(chan error, 1)
+			go func() {
+				if tlsCert == "" {
+					logrus.Infoln("Serve shiori in", svr.Addr)
+					failed <- svr.ListenAndServe()
+				} else {
+					logrus.Infoln("Serve shiori with HTTPS in", svr.Addr)
+					failed <- svr.ListenAndServeTLS(tlsCert, tlsKey)
+				}
+			}()
 
-			router.POST("/api/login", apiLogin)
-			router.GET("/api/bookmarks", apiGetBookmarks)
-			router.GET("/api/tags", apiGetTags)
-			router.POST("/api/bookmarks", apiInsertBookmarks)
-			router.PUT("/api/bookmarks", apiUpdateBookmarks)
-			router.DELETE("/api/bookmarks", apiDeleteBookmarks)
+			// Redirect plain HTTP to HTTPS. Failing to do so, e.g. when the port
+			// needs root, doesn't stop shiori from serving HTTPS.
+			redirectPort, _ := cmd.Flags().GetInt("redirect-port")
+			if tlsCert != "" && redirectPort > 0 {
+				redirectSvr := &http.Server{
+					Addr:         net.JoinHostPort(address, strconv.Itoa(redirectPort)),
+					Handler:      redirectToHTTPS(port),
+					ReadTimeout:  readTimeout,
+					WriteTimeout: writeTimeout,
+					IdleTimeout:  idleTimeout,
+				}
+				servers = append(servers, redirectSvr)
 
-			// Route for panic
-			router.PanicHandler = func(w http.ResponseWriter, r *http.Request, arg interface{}) {
-				http.Error(w, fmt.Sprint(arg), 500)
+				go func() {
+					logrus.Infoln("Redirect HTTP in", redirectSvr.Addr, "to HTTPS")
+					if err := redirectSvr.ListenAndServe(); err != http.ErrServerClosed {
+						logrus.Warnln("Failed to redirect HTTP to HTTPS:", err)
+					}
+				}()
 			}
 
-			port, _ := cmd.Flags().GetInt("port")
-			url := fmt.Sprintf(":%d", port)
-			logrus.Infoln("Serve shiori in", url)
-			svr := &http.Server{
-				Addr:         url,
-				Handler:      router,
-				ReadTimeout:  10 * time.Second,
-				WriteTimeout: 20 * time.Second,
+			// Serve until server fails or is asked to stop, e.g. by docker stop
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+			var errServe error
+			select {
+			case errServe = <-failed:
+			case sig := <-signals:
+				logrus.Infoln("Received", sig, "signal, shutting down server")
+			}
+
+			shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+			if err = shutdownServer(servers, stopJobs, &serverJobs, shutdownTimeout); err != nil {
+				logrus.Warnln("Failed to shut down server gracefully:", err)
+			}
+
+			if errServe != nil {
+				logrus.Fatalln(errServe)
 			}
-			logrus.Fatalln(svr.ListenAndServe())
 		},
 	}
 )
 
 func init() {
+	serveCmd.Flags().StringP("address", "a", "", "Address that used by server, e.g. 127.0.0.1 to only serve this machine. "+
+		"Defaults to every address")
 	serveCmd.Flags().IntP("port", "p", 8080, "Port that used by server")
+	serveCmd.Flags().String("key-file", "", "File of the key for signing login tokens, generated on first run. "+
+		"Defaults to $HOME/.shiori.key, ignored if ENV_SHIORI_JWT_KEY is set")
+	serveCmd.Flags().String("tls-cert", "", "Certificate file for serving HTTPS, used with --tls-key")
+	serveCmd.Flags().String("tls-key", "", "Private key file of the certificate for serving HTTPS")
+	serveCmd.Flags().Bool("self-signed", false, "Serve HTTPS with self-signed certificate, generated if it doesn't exist yet. "+
+		"Saved in --tls-cert and --tls-key, defaulting to $HOME/.shiori-cert.pem and $HOME/.shiori-key.pem")
+	serveCmd.Flags().Int("redirect-port", 80, "Port that redirects plain HTTP to HTTPS when serving HTTPS, 0 to disable")
+	serveCmd.Flags().Duration("read-timeout", 10*time.Second, "Maximum duration for reading the whole request")
+	serveCmd.Flags().Duration("write-timeout", 0, "Maximum duration for writing the response, 0 for no limit so large videos can be downloaded")
+	serveCmd.Flags().Duration("idle-timeout", 2*time.Minute, "Maximum duration to keep idle connection open")
+	serveCmd.Flags().Duration("shutdown-timeout", 10*time.Second, "Maximum duration to wait for running requests "+
+		"and background jobs when server is stopped")
+	serveCmd.Flags().String("base-path", "", "Path prefix of every page, e.g. /shiori to serve it under sub-path of reverse proxy")
+	serveCmd.Flags().Bool("trust-proxy", false, "Use X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Prefix headers "+
+		"sent by reverse proxy. Only enable it behind a proxy, since clients can send these headers too")
 	rootCmd.AddCommand(serveCmd)
 }
 
+// newRouter returns the router of every page and API route served by shiori.
+func newRouter() *httprouter.Router {
+	router := httprouter.New()
+
+	router.GET("/js/*filepath", serveFiles)
+	router.GET("/res/*filepath", serveFiles)
+	router.GET("/css/*filepath", serveFiles)
+	router.GET("/webfonts/*filepath", serveFiles)
+
+	router.GET("/videos/*filepath", serveVideo)
+
+	router.GET("/", serveIndexPage)
+	router.GET("/login", serveLoginPage)
+	router.GET("/bookmark/:id", serveBookmarkCache)
+
+	router.POST("/api/login", apiLogin)
+	router.POST("/api/logout", apiLogout)
+	router.GET("/api/trash", apiGetTrash)
+	router.POST("/api/trash/restore", apiRestoreTrash)
+	router.DELETE("/api/trash", apiEmptyTrash)
+	router.GET("/api/accounts", apiGetAccounts)
+	router.POST("/api/accounts", apiInsertAccount)
+	router.DELETE("/api/accounts", apiDeleteAccounts)
+	router.PUT("/api/accounts/me/password", apiChangePassword)
+
+	for _, route := range apiV1Routes {
+		router.Handle(route.method, "/api/v1"+route.path, route.handle)
+	}
+
+	// Routes replaced by versioned API, kept for older clients
+	router.GET("/api/bookmarks", deprecated(apiGetBookmarks))
+	router.POST("/api/bookmarks", deprecated(apiInsertBookmarks))
+	router.PUT("/api/bookmarks", deprecated(apiUpdateBookmarks))
+	router.DELETE("/api/bookmarks", deprecated(apiDeleteBookmarks))
+	router.PUT("/api/bookmarks/public", deprecated(apiSetBookmarksPublic))
+	router.GET("/api/tags", deprecated(apiGetTags))
+	router.PUT("/api/tags/:id", deprecated(apiRenameTag))
+	router.DELETE("/api/tags/:id", deprecated(apiDeleteTag))
+
+	// Route for panic
+	router.PanicHandler = func(w http.ResponseWriter, r *http.Request, arg interface{}) {
+		writeError(w, fmt.Errorf("Panic while serving %s: %v", r.URL.Path, arg))
+	}
+
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, database.NewError(database.ErrNotFound, "Page not found"))
+	})
+
+	return router
+}
+
+// shutdownServer stops the servers from accepting new requests and stops background jobs,
+// then waits for the running requests and jobs to finish, up to the timeout. Jobs are
+// waited for after the requests, since running requests may still start new ones.
+func shutdownServer(servers []*http.Server, stopJobs context.CancelFunc, jobs *sync.WaitGroup, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopJobs()
+
+	var errShutdown error
+	for _, svr := range servers {
+		if err := svr.Shutdown(ctx); err != nil {
+			// Requests that take too long are cut off
+			svr.Close()
+			errShutdown = fmt.Errorf("Requests didn't finish in time: %v", err)
+		}
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		if errShutdown == nil {
+			errShutdown = fmt.Errorf("Background jobs didn't finish in time")
+		}
+	}
+
+	return errShutdown
+}
+
 func serveFiles(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Read asset path
 	path := r.URL.Path
@@ -108,7 +320,10 @@ func serveFiles(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Load asset
 	asset, err := assets.ReadFile(path)
-	checkError(err)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 
 	// Set response header content type
 	ext := fp.Ext(path)
@@ -130,11 +345,7 @@ func serveIndexPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		return
 	}
 
-	asset, _ := assets.ReadFile("index.html")
-	w.Header().Set("Content-Type", "text/html")
-	buffer := bytes.NewBuffer(asset)
-	io.Copy(w, buffer)
-
+	servePage(w, r, "index.html")
 }
 
 func serveLoginPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -145,48 +356,186 @@ func serveLoginPage(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		return
 	}
 
-	asset, _ := assets.ReadFile("login.html")
+	servePage(w, r, "login.html")
+}
+
+// servePage serves HTML page, with its base URL pointing to the base path of shiori.
+// Every URL in the page is relative, so it follows the base URL.
+func servePage(w http.ResponseWriter, r *http.Request, name string) {
+	asset, _ := assets.ReadFile(name)
+	baseTag := []byte(`<base href="` + template.HTMLEscapeString(publicBasePath(r)) + `/">`)
+	asset = bytes.Replace(asset, []byte(`<base href="/">`), baseTag, 1)
+
 	w.Header().Set("Content-Type", "text/html")
 	buffer := bytes.NewBuffer(asset)
 	io.Copy(w, buffer)
 }
 
-func serveBookmarkCache(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// Read param in URL
-	id := ps.ByName("id")
+// cachePage is the data of cached page template, i.e. the bookmark and
+// the base path of shiori that prefixes the URL of assets.
+type cachePage struct {
+	model.Bookmark
+	BasePath string
+}
 
-	// Read bookmarks
-	bookmarks, err := DB.GetBookmarks(true, id)
-	checkError(err)
+func serveBookmarkCache(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Read bookmark, as long as the request is allowed to read it
+	bookmark, err := readableBookmark(r, ps.ByName("id"), true)
+	if errors.Is(err, errUnauthorized) {
+		redirectPage(w, r, "/login")
+		return
+	}
 
-	if len(bookmarks) == 0 {
-		panic(fmt.Errorf("No bookmark with matching index"))
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
+	// Archived page comes from elsewhere, so don't let it run anything in our origin
+	w.Header().Set("Content-Security-Policy", cacheContentPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
 	// Read template
-	err = tplCache.Execute(w, &bookmarks[0])
-	checkError(err)
+	err = tplCache.Execute(w, &cachePage{Bookmark: bookmark, BasePath: publicBasePath(r)})
+	if err != nil {
+		logrus.Errorln("Failed to render bookmark cache:", err)
+	}
+}
+
+func serveVideo(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Videos are saved right in videos directory, so path of any other file is refused.
+	// Title of video may contain dots, so only the path elements . and .. are refused.
+	filename := strings.TrimPrefix(ps.ByName("filepath"), "/")
+	if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+		writeError(w, database.NewError(database.ErrNotFound, "Video doesn't exist"))
+		return
+	}
+
+	// Find the bookmarks that own the video, since the video can only be watched by whoever
+	// can read one of them. The file is shared by bookmarks of the same video in every account.
+	bookmarkIDs, err := DB.GetVideoBookmarks(filename)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var errRead error
+	for _, bookmarkID := range bookmarkIDs {
+		_, err = readableBookmark(r, strconv.FormatInt(bookmarkID, 10), false)
+		if err == nil {
+			errRead = nil
+			break
+		}
+
+		if errRead == nil {
+			errRead = err
+		}
+	}
+
+	if errRead != nil {
+		writeError(w, errRead)
+		return
+	}
+
+	http.ServeFile(w, r, fp.Join("videos", filename))
+}
+
+// readableBookmark returns the bookmark with the specified ID, if the request is allowed
+// to read it. Bookmark can be read by its account, or by anyone if it's shared publicly.
+func readableBookmark(r *http.Request, id string, withContent bool) (model.Bookmark, error) {
+	account, errAuth := checkAPIToken(r, database.RoleViewer, false)
+	if errAuth == nil {
+		bookmarks, err := DB.ForAccount(account.ID).GetBookmarks(withContent, database.Page{}, id)
+		if err != nil {
+			return model.Bookmark{}, err
+		}
+
+		if len(bookmarks) > 0 {
+			return bookmarks[0], nil
+		}
+	}
+
+	bookmarks, err := DB.ForAccount(0).GetBookmarks(withContent, database.Page{}, id)
+	if err != nil {
+		return model.Bookmark{}, err
+	}
+
+	if len(bookmarks) > 0 && bookmarks[0].Public {
+		return bookmarks[0], nil
+	}
+
+	// Without login, private bookmark looks the same as missing one
+	if errAuth != nil {
+		return model.Bookmark{}, errAuth
+	}
+
+	return model.Bookmark{}, database.NewError(database.ErrNotFound, "No bookmark with matching index")
 }
 
 func apiLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Decode request
 	var request model.LoginRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
-	checkError(err)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Refuse login while the username or address is locked out
+	now := time.Now()
+	address := clientAddress(r)
+	userKey, addrKey := usernameKey(request.Username), addressKey(address)
+	if until := loginAttempts.lockedUntil(now, userKey, addrKey); !until.IsZero() {
+		recordAuthEvent(authEventFailure, request.Username, address, "Refused while locked out")
+		w.Header().Set("Retry-After", retryAfter(now, until))
+		writeError(w, withDetails(database.NewError(errTooManyRequests, "Too many failed logins, try again later"),
+			map[string]string{"retryAfter": retryAfter(now, until)}))
+		return
+	}
 
 	// Get account data from database
 	accounts, err := DB.GetAccounts(request.Username, true)
-	if err != nil || len(accounts) == 0 {
-		panic(fmt.Errorf("Account does not exist"))
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	// Compare password with database
-	account := accounts[0]
-	err = bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(request.Password))
-	if err != nil {
-		panic(fmt.Errorf("Username and password don't match"))
+	// Compare password with database. Missing account fails the same way as
+	// wrong password, so the response doesn't tell which usernames exist.
+	failure, hashedPassword := "", dummyPasswordHash
+	if len(accounts) == 0 {
+		failure = "Account doesn't exist"
+	} else {
+		hashedPassword = accounts[0].Password
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(request.Password))
+	if err != nil && failure == "" {
+		failure = "Wrong password"
+	}
+
+	if failure != "" {
+		recordAuthEvent(authEventFailure, request.Username, address, failure)
+
+		userLocked := loginAttempts.fail(now, userKey, maxUsernameFailures)
+		addrLocked := loginAttempts.fail(now, addrKey, maxAddressFailures)
+		if userLocked {
+			recordAuthEvent(authEventLockout, request.Username, address,
+				fmt.Sprintf("Username locked out for %v", loginLockout))
+		}
+		if addrLocked {
+			recordAuthEvent(authEventLockout, request.Username, address,
+				fmt.Sprintf("Address locked out for %v", loginLockout))
+		}
+
+		writeError(w, database.NewError(errUnauthorized, "Username and password don't match"))
+		return
 	}
 
+	account := accounts[0]
+	loginAttempts.reset(userKey)
+	recordAuthEvent(authEventSuccess, account.Username, address, "Logged in")
+
 	// Calculate expiration time
 	nbf := time.Now()
 	exp := time.Now().Add(12 * time.Hour)
@@ -194,68 +543,223 @@ func apiLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		exp = time.Now().Add(7 * 24 * time.Hour)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"nbf": nbf.Unix(),
-		"exp": exp.Unix(),
-		"sub": account.ID,
-	})
-
-	tokenString, err := token.SignedString(jwtKey)
-	checkError(err)
+	tokenString, err := createSession(account.ID, nbf, exp)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	// Return token
+	// Save token in cookie for web interface, and return it for scripts
+	http.SetCookie(w, tokenCookie(r, tokenString, exp))
 	fmt.Fprint(w, tokenString)
 }
 
+func apiLogout(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, then revoke its session
+	tokenString, err := requestToken(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		writeError(w, database.NewError(database.ErrValidation, "API token can't log out, revoke it instead"))
+		return
+	}
+
+	session, err := parseToken(tokenString)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	_, err = DB.DeleteSessions(session.AccountID, session.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Remove cookie, since browser scripts can't
+	cookie := tokenCookie(r, "", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+
+	fmt.Fprint(w, "Logged out")
+}
+
 func apiGetBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// Get query parameter
-	keyword := r.URL.Query().Get("keyword")
+	// Get query parameter. The keyword parameter is the
+	// older name of q, kept for compatibility.
+	strQuery := r.URL.Query().Get("q")
+	if strQuery == "" {
+		strQuery = r.URL.Query().Get("keyword")
+	}
+
 	strTags := r.URL.Query().Get("tags")
+	strSort := r.URL.Query().Get("sort")
 	tags := strings.Fields(strTags)
 
-	// Check token
-	err := checkAPIToken(r)
-	checkError(err)
+	// Check token, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleViewer, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	query, err := database.ParseQuery(strQuery)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query = query.WithTags(tags...)
 
-	// Fetch all bookmarks
-	bookmarks, err := DB.SearchBookmarks(true, keyword, tags...)
-	checkError(err)
+	// Web interface shows the newest bookmarks first, unless searching by keyword
+	order := database.SortNewest
+	if strSort != "" || query.HasKeyword() {
+		order, err = database.ParseSortOrder(strSort)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	page, number, err := pageFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Fetch bookmarks in the requested page
+	bookmarks, total, err := db.SearchBookmarks(order, page, query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	err = json.NewEncoder(w).Encode(&bookmarks)
-	checkError(err)
+	writeJSON(w, &model.BookmarkPage{
+		Bookmarks: bookmarks,
+		Page:      number,
+		Limit:     page.Limit,
+		Total:     total,
+	})
 }
 
 func apiGetTags(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-
-	// Check token
-	err := checkAPIToken(r)
-	checkError(err)
+	// Check token, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleViewer, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
 
 	// Fetch all tags
-	tags, err := DB.GetTags()
-	checkError(err)
+	tags, err := db.GetTags()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-	err = json.NewEncoder(w).Encode(&tags)
-	checkError(err)
+	writeJSON(w, &tags)
+}
+
+func apiRenameTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := tagIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request
+	request := model.Tag{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Rename tag
+	tag, err := db.RenameTag(id, request.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &tag)
+}
+
+func apiDeleteTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	id, err := tagIDFromParams(ps)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Delete tag
+	err = db.DeleteTags(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tagIDFromParams reads the tag ID from URL parameter.
+func tagIDFromParams(ps httprouter.Params) (int64, error) {
+	id, err := strconv.ParseInt(ps.ByName("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, database.NewError(database.ErrValidation, "Tag ID must be a positive number")
+	}
+
+	return id, nil
 }
 
 func apiInsertBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// Check token
-	err := checkAPIToken(r)
-	checkError(err)
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
 
 	// Decode request
 	request := model.Bookmark{}
 	err = json.NewDecoder(r.Body).Decode(&request)
-	checkError(err)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
 
-	// Save bookmark
-	book, err := addBookmark(request, false)
-	checkError(err)
+	// Save bookmark. Server waits for it when shutting down, so video isn't left half downloaded.
+	serverJobs.Add(1)
+	book, err := addBookmark(db, request, false)
+	serverJobs.Done()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	// Return new saved result
-	err = json.NewEncoder(w).Encode(&book)
-	checkError(err)
+	writeJSON(w, &book)
 }
 
 func apiUpdateBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -263,67 +767,619 @@ func apiUpdateBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	_, dontOverwrite := r.URL.Query()["dont-overwrite"]
 	overwrite := !dontOverwrite
 
-	// Check token
-	err := checkAPIToken(r)
-	checkError(err)
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
 
 	// Decode request
 	request := model.Bookmark{}
 	err = json.NewDecoder(r.Body).Decode(&request)
-	checkError(err)
-
-	// Convert tags and ID
-	id := []string{fmt.Sprintf("%d", request.ID)}
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
 
 	// Update bookmark
-	bookmarks, err := updateBookmarks(id, request, false, overwrite)
-	checkError(err)
+	patch, tagChanges := legacyBookmarkPatch(request, overwrite)
+	id := []string{fmt.Sprintf("%d", request.ID)}
+	serverJobs.Add(1)
+	bookmarks, err := updateBookmarks(db, id, patch, tagChanges, false, overwrite, nil)
+	serverJobs.Done()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	// Return new saved result
-	err = json.NewEncoder(w).Encode(&bookmarks[0])
-	checkError(err)
+	writeJSON(w, &bookmarks[0])
+}
+
+// legacyBookmarkPatch converts request of the deprecated update route into patch and tag changes.
+// The route only changes title and excerpt when overwriting, and empty value keeps the one fetched
+// from web. Older clients send "empty" excerpt for the same purpose.
+func legacyBookmarkPatch(request model.Bookmark, overwrite bool) (model.BookmarkPatch, []string) {
+	patch := model.BookmarkPatch{}
+	if request.URL != "" {
+		patch.URL = &request.URL
+	}
+
+	if overwrite && request.Title != "" {
+		patch.Title = &request.Title
+	}
+
+	if overwrite && request.Excerpt != "" && request.Excerpt != "empty" {
+		patch.Excerpt = &request.Excerpt
+	}
+
+	tagChanges := []string{}
+	for _, tag := range request.Tags {
+		tagChanges = append(tagChanges, tag.Name)
+	}
+
+	return patch, tagChanges
 }
 
 func apiDeleteBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// Check token
-	err := checkAPIToken(r)
-	checkError(err)
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
 
 	// Decode request
 	request := []string{}
 	err = json.NewDecoder(r.Body).Decode(&request)
-	checkError(err)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
 
 	// Delete bookmarks
-	err = DB.DeleteBookmarks(request...)
-	checkError(err)
+	err = db.DeleteBookmarks(request...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	fmt.Fprint(w, request)
 }
 
+func apiSetBookmarksPublic(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	// Decode request. Unlike other requests, empty list is refused
+	// so every bookmark is never shared by accident.
+	request := model.PublicRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	if len(request.IDs) == 0 {
+		writeError(w, database.NewError(database.ErrValidation, "IDs must not be empty"))
+		return
+	}
+
+	// Share or stop sharing bookmarks
+	nUpdated, err := db.SetBookmarksPublic(request.Public, request.IDs...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]int{"updated": nUpdated})
+}
+
+func apiGetTrash(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleViewer, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	page, number, err := pageFromRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Fetch bookmarks in trash
+	bookmarks, total, err := db.GetDeletedBookmarks(page)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &model.BookmarkPage{
+		Bookmarks: bookmarks,
+		Page:      number,
+		Limit:     page.Limit,
+		Total:     total,
+	})
+}
+
+func apiRestoreTrash(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	// Decode request, empty list restores all bookmarks in trash
+	request := []string{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Restore bookmarks
+	nRestored, err := db.RestoreBookmarks(request...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if nRestored == 0 {
+		writeError(w, database.NewError(database.ErrNotFound, "No matching bookmarks in trash"))
+		return
+	}
+
+	writeJSON(w, map[string]int{"restored": nRestored})
+}
+
+func apiEmptyTrash(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token and role, then work on bookmarks and tags of its account
+	account, err := checkAPIToken(r, database.RoleEditor, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	db := DB.ForAccount(account.ID)
+
+	// Decode request, empty list removes all bookmarks in trash
+	request := []string{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Remove bookmarks permanently
+	nPurged, err := purgeBookmarks(db, time.Time{}, request...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]int{"purged": nPurged})
+}
+
+func apiGetAccounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, only admin can see the accounts
+	_, err := checkAPIToken(r, database.RoleAdmin, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Fetch accounts, their passwords are never encoded in response
+	accounts, err := DB.GetAccounts(r.URL.Query().Get("q"), false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &accounts)
+}
+
+func apiInsertAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, only admin can create account
+	_, err := checkAPIToken(r, database.RoleAdmin, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request
+	request := model.AccountRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Save account, then return it
+	err = addAccount(request.Username, request.Password, request.Role)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	account, err := findAccount(request.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, &account)
+}
+
+func apiDeleteAccounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, only admin can delete accounts
+	account, err := checkAPIToken(r, database.RoleAdmin, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request. Unlike bookmarks, empty list is refused since
+	// removing every account would lock everyone out of web interface.
+	request := []string{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	if len(request) == 0 {
+		writeError(w, database.NewError(database.ErrValidation, "Usernames must not be empty"))
+		return
+	}
+
+	for _, username := range request {
+		if username == account.Username {
+			writeError(w, database.NewError(database.ErrValidation, "Account can't delete itself"))
+			return
+		}
+	}
+
+	// Delete accounts
+	err = DB.DeleteAccounts(request...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	fmt.Fprint(w, request)
+}
+
+func apiChangePassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Check token, every account can change its own password
+	account, err := checkAPIToken(r, database.RoleViewer, true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Decode request
+	request := model.PasswordRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, invalidRequest(err))
+		return
+	}
+
+	// Login of this request stays, while the other sessions are logged out
+	keepSessionID := ""
+	if tokenString, _ := requestToken(r); !strings.HasPrefix(tokenString, apiTokenPrefix) {
+		session, err := parseToken(tokenString)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		keepSessionID = session.ID
+	}
+
+	// Change password after checking the old one
+	err = changePassword(account.Username, request.OldPassword, request.NewPassword, keepSessionID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	fmt.Fprint(w, "Password has been changed")
+}
+
+// pageFromRequest reads limit and page parameters from URL query.
+// By default it returns the first page with defaultPageLimit bookmarks.
+func pageFromRequest(r *http.Request) (database.Page, int, error) {
+	limit, number := defaultPageLimit, 1
+	errInvalidPage := database.NewError(database.ErrValidation, "Limit and page must be positive numbers")
+
+	var err error
+	if strLimit := r.URL.Query().Get("limit"); strLimit != "" {
+		limit, err = strconv.Atoi(strLimit)
+		if err != nil || limit < 1 {
+			return database.Page{}, 0, errInvalidPage
+		}
+	}
+
+	if strPage := r.URL.Query().Get("page"); strPage != "" {
+		number, err = strconv.Atoi(strPage)
+		if err != nil || number < 1 {
+			return database.Page{}, 0, errInvalidPage
+		}
+	}
+
+	page, err := database.NewPage(limit, number)
+	return page, number, err
+}
+
+// writeJSON encodes data as JSON response.
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		logrus.Errorln("Failed to encode response:", err)
+	}
+}
+
+// errorKinds is the HTTP status and the code in API response of each kind of error,
+// so clients can tell what went wrong without parsing the message.
+var errorKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{errForbidden, http.StatusForbidden, "forbidden"},
+	{errTooManyRequests, http.StatusTooManyRequests, "too_many_requests"},
+	{database.ErrNotFound, http.StatusNotFound, "not_found"},
+	{database.ErrConflict, http.StatusConflict, "conflict"},
+	{database.ErrInvalidIndex, http.StatusBadRequest, "invalid_index"},
+	{database.ErrValidation, http.StatusBadRequest, "invalid_request"},
+}
+
+// detailedError is an error with details for API response, e.g. why the request can't be decoded.
+type detailedError struct {
+	error
+	details interface{}
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.error
+}
+
+// withDetails adds details to err, which are sent along with its message.
+func withDetails(err error, details interface{}) error {
+	return &detailedError{error: err, details: details}
+}
+
+// invalidRequest returns the error of request body that can't be decoded.
+func invalidRequest(err error) error {
+	return withDetails(database.NewError(database.ErrValidation, "Request is not valid"), err.Error())
+}
+
+// writeError writes err as JSON with HTTP status that matches its kind.
+// Unknown errors are logged and hidden behind a generic message.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	response := model.ErrorResponse{Code: "internal_error", Message: "Internal server error"}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			status = k.status
+			response = model.ErrorResponse{Code: k.code, Message: err.Error()}
+			break
+		}
+	}
+
+	var detailed *detailedError
+	if status == http.StatusInternalServerError {
+		logrus.Errorln(err)
+	} else if errors.As(err, &detailed) {
+		response.Details = detailed.details
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	writeJSON(w, &response)
+}
+
 func checkToken(r *http.Request) error {
 	tokenCookie, err := r.Cookie("token")
 	if err != nil {
 		return fmt.Errorf("Token does not exist")
 	}
 
-	token, err := jwt.Parse(tokenCookie.Value, jwtKeyFunc)
+	_, err = parseToken(tokenCookie.Value)
+	return err
+}
+
+// checkAPIToken validates the login token or API token of the request, and makes
+// sure the account that owns the token has at least the specified role. Handler that
+// changes anything must set write, which read-only API token isn't allowed to do.
+func checkAPIToken(r *http.Request, role database.Role, write bool) (model.Account, error) {
+	tokenString, err := requestToken(r)
 	if err != nil {
-		return err
+		return model.Account{}, err
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	return claims.Valid()
+	return checkTokenAccount(tokenString, role, write)
+}
+
+// requestToken returns the token in Authorization header or, if there's none, the login
+// token in cookie, so API can be used from scripts and from browser alike.
+func requestToken(r *http.Request) (string, error) {
+	if r.Header.Get("Authorization") != "" {
+		tokenString, err := request.AuthorizationHeaderExtractor.ExtractToken(r)
+		if err != nil {
+			return "", database.NewError(errUnauthorized, err.Error())
+		}
+
+		return tokenString, nil
+	}
+
+	tokenCookie, err := r.Cookie("token")
+	if err != nil {
+		return "", database.NewError(errUnauthorized, "Token does not exist")
+	}
+
+	return tokenCookie.Value, nil
+}
+
+// checkTokenAccount validates the login token or API token, and makes sure the account
+// that owns the token has at least the specified role, and that the token is allowed to write
+// if write is set. Returns the account, so its role always comes from the database.
+func checkTokenAccount(tokenString string, role database.Role, write bool) (model.Account, error) {
+	// Token is either API token, or login token of a session
+	var accountID int64
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		apiToken, err := DB.UseAPIToken(hashAPIToken(tokenString))
+		if errors.Is(err, database.ErrNotFound) {
+			return model.Account{}, database.NewError(errUnauthorized, "Token has been revoked or doesn't exist")
+		}
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if apiToken.ReadOnly && write {
+			return model.Account{}, database.NewError(errForbidden, "Token is only allowed to read")
+		}
+		accountID = apiToken.AccountID
+	} else {
+		session, err := parseToken(tokenString)
+		if err != nil {
+			return model.Account{}, err
+		}
+		accountID = session.AccountID
+	}
+
+	account, err := DB.GetAccount(accountID)
+	if errors.Is(err, database.ErrNotFound) {
+		return model.Account{}, database.NewError(errUnauthorized, "Account of the token doesn't exist anymore")
+	}
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	if !database.Role(account.Role).Includes(role) {
+		return model.Account{}, database.NewError(errForbidden,
+			fmt.Sprintf("Account with role %s is not allowed to do this", account.Role))
+	}
+
+	return account, nil
+}
+
+// createSession records new session of the account, valid from nbf until exp.
+// Returns the signed token, which carries ID of the session.
+func createSession(accountID int64, nbf, exp time.Time) (string, error) {
+	sessionID := make([]byte, 16)
+	if _, err := rand.Read(sessionID); err != nil {
+		return "", err
+	}
+
+	session := model.Session{
+		ID:        hex.EncodeToString(sessionID),
+		AccountID: accountID,
+		Created:   nbf.UTC().Format("2006-01-02 15:04:05"),
+		Expires:   exp.UTC().Format("2006-01-02 15:04:05"),
+	}
+
+	if err := DB.CreateSession(session); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": session.ID,
+		"nbf": nbf.Unix(),
+		"exp": exp.Unix(),
+		"sub": accountID,
+	})
+
+	return token.SignedString(jwtKey)
 }
 
-func checkAPIToken(r *http.Request) error {
-	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, jwtKeyFunc)
+// parseToken validates the signed token, and makes sure its session hasn't been revoked.
+func parseToken(tokenString string) (model.Session, error) {
+	token, err := jwt.Parse(tokenString, jwtKeyFunc)
 	if err != nil {
-		return err
+		return model.Session{}, database.NewError(errUnauthorized, err.Error())
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
-	return claims.Valid()
+	if err = claims.Valid(); err != nil {
+		return model.Session{}, database.NewError(errUnauthorized, err.Error())
+	}
+
+	sessionID, _ := claims["jti"].(string)
+	if sessionID == "" {
+		return model.Session{}, database.NewError(errUnauthorized, "Token doesn't belong to any session")
+	}
+
+	session, err := DB.GetSession(sessionID)
+	if errors.Is(err, database.ErrNotFound) {
+		return model.Session{}, database.NewError(errUnauthorized, "Session has been revoked or has expired")
+	}
+
+	return session, err
+}
+
+// loadJWTKey returns the key for signing tokens from ENV_SHIORI_JWT_KEY or the key file.
+// If neither exists, new key is generated and saved into the key file.
+func loadJWTKey(keyFile string) ([]byte, error) {
+	if key := os.Getenv("ENV_SHIORI_JWT_KEY"); key != "" {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("ENV_SHIORI_JWT_KEY must be at least 32 characters")
+		}
+
+		return []byte(key), nil
+	}
+
+	if keyFile == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		keyFile = fp.Join(homeDir, ".shiori.key")
+	}
+
+	key, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		key = bytes.TrimSpace(key)
+		if len(key) < 32 {
+			return nil, fmt.Errorf("Key in %s must be at least 32 characters", keyFile)
+		}
+
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Generate new key, only readable by the current user
+	randomKey := make([]byte, 32)
+	if _, err = rand.Read(randomKey); err != nil {
+		return nil, err
+	}
+
+	key = []byte(hex.EncodeToString(randomKey))
+	if err = ioutil.WriteFile(keyFile, key, 0600); err != nil {
+		return nil, err
+	}
+
+	logrus.Infoln("Generated new key for token in", keyFile)
+	return key, nil
 }
 
 func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
@@ -338,5 +1394,5 @@ func redirectPage(w http.ResponseWriter, r *http.Request, url string) {
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
-	http.Redirect(w, r, url, 301)
+	http.Redirect(w, r, publicBasePath(r)+url, 301)
 }
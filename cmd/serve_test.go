@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestShutdownServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	// Request that is still running when server is stopped
+	started := make(chan struct{})
+	svr := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("finished"))
+	})}
+	go svr.Serve(listener)
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-started
+
+	// Background job that stops when asked
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobs := sync.WaitGroup{}
+	jobs.Add(1)
+	jobStopped := false
+	go func() {
+		defer jobs.Done()
+		purgeTrashPeriodically(jobsCtx, time.Hour)
+		jobStopped = true
+	}()
+
+	if err = shutdownServer([]*http.Server{svr}, stopJobs, &jobs, 5*time.Second); err != nil {
+		t.Errorf("expected graceful shutdown, got %v", err)
+	}
+	if body := <-response; body != "finished" {
+		t.Errorf("expected running request to finish, got %q", body)
+	}
+	if !jobStopped {
+		t.Errorf("expected background job to stop")
+	}
+
+	// Server no longer accepts requests
+	if _, err = http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Errorf("expected stopped server to refuse requests")
+	}
+
+	// Jobs that don't stop in time are reported
+	jobs.Add(1)
+	err = shutdownServer(nil, func() {}, &jobs, 10*time.Millisecond)
+	jobs.Done()
+	if err == nil {
+		t.Errorf("expected error when background job doesn't stop")
+	}
+}
+
+func TestSetFlagsFromEnv(t *testing.T) {
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("address", "", "")
+		cmd.Flags().Duration("write-timeout", 0, "")
+		return cmd
+	}
+	envs := map[string]string{"address": "ENV_SHIORI_TEST_ADDRESS", "write-timeout": "ENV_SHIORI_TEST_WRITE_TIMEOUT"}
+
+	os.Setenv("ENV_SHIORI_TEST_ADDRESS", "127.0.0.1")
+	os.Setenv("ENV_SHIORI_TEST_WRITE_TIMEOUT", "1m")
+	defer os.Unsetenv("ENV_SHIORI_TEST_ADDRESS")
+	defer os.Unsetenv("ENV_SHIORI_TEST_WRITE_TIMEOUT")
+
+	// Environment variable is used when flag isn't specified
+	cmd := newCmd()
+	cmd.Flags().Set("address", "::1")
+	if err := setFlagsFromEnv(cmd, envs); err != nil {
+		t.Fatalf("failed to set flags: %v", err)
+	}
+
+	address, _ := cmd.Flags().GetString("address")
+	writeTimeout, _ := cmd.Flags().GetDuration("write-timeout")
+	if address != "::1" || writeTimeout != time.Minute {
+		t.Errorf("expected flag to win over environment, got %q and %v", address, writeTimeout)
+	}
+
+	// Invalid value is reported with the name of its variable
+	os.Setenv("ENV_SHIORI_TEST_WRITE_TIMEOUT", "soon")
+	if err := setFlagsFromEnv(newCmd(), envs); err == nil {
+		t.Errorf("expected error with invalid duration")
+	}
+}
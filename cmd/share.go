@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	shareCmd = &cobra.Command{
+		Use:   "share indices",
+		Short: "Share the saved bookmarks publicly",
+		Long: "Share bookmarks, so their cache and video in web interface can be opened without login. " +
+			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9).",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			nShared, err := DB.SetBookmarksPublic(true, args...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d bookmark(s) shared\n", nShared)
+		},
+	}
+
+	unshareCmd = &cobra.Command{
+		Use:   "unshare [indices]",
+		Short: "Stop sharing the saved bookmarks",
+		Long: "Stop sharing bookmarks, so only their account can open them in web interface. " +
+			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
+			"If no arguments, all bookmarks will stop being shared.",
+		Run: func(cmd *cobra.Command, args []string) {
+			nUnshared, err := DB.SetBookmarksPublic(false, args...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d bookmark(s) no longer shared\n", nUnshared)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(unshareCmd)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/s-frostick/shiori/model"
+)
+
+func TestBookmarkAccess(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	jwtKey = []byte("test-key")
+	tplCache = template.Must(template.New("cache.html").Parse(`{{.Title}}`))
+
+	tokens := map[string]string{}
+	for _, username := range []string{"alice", "bob"} {
+		if err := addAccount(username, "fooBar123", "editor"); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+
+		account, err := findAccount(username)
+		if err != nil {
+			t.Fatalf("failed to find test account: %v", err)
+		}
+		tokens[username] = signTestToken(t, account.ID)
+	}
+
+	alice, _ := findAccount("alice")
+	book, err := addBookmark(DB.ForAccount(alice.ID), model.Bookmark{URL: "https://example.com/private", Title: "Private page"}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+	id := strconv.FormatInt(book.ID, 10)
+
+	// Video of the bookmark is served from videos directory
+	if _, err = DB.CreateVideo(book.ID, model.Video{Filename: "access-test.mp4", Downloaded: true}); err != nil {
+		t.Fatalf("failed to create testing video: %v", err)
+	}
+
+	if _, err = os.Stat("videos"); os.IsNotExist(err) {
+		if err = os.Mkdir("videos", 0755); err != nil {
+			t.Fatalf("failed to create videos directory: %v", err)
+		}
+		defer os.RemoveAll("videos")
+	}
+	if err = ioutil.WriteFile("videos/access-test.mp4", []byte("video data"), 0644); err != nil {
+		t.Fatalf("failed to create testing video: %v", err)
+	}
+	defer os.Remove("videos/access-test.mp4")
+
+	type access struct {
+		name       string
+		cookie     string
+		header     string
+		wantStatus int
+	}
+
+	check := func(stage string, handler httprouter.Handle, path string, ps httprouter.Params, want string, tests []access) {
+		for _, tt := range tests {
+			r := httptest.NewRequest("GET", path, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, r, ps)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s, %s: expected status %d, got %d (%s)", stage, tt.name, tt.wantStatus, w.Code, w.Body)
+			} else if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s, %s: expected %q, got %q", stage, tt.name, want, w.Body)
+			}
+		}
+	}
+
+	cachePath, cacheParams := "/bookmark/"+id, httprouter.Params{{Key: "id", Value: id}}
+	videoPath, videoParams := "/videos/access-test.mp4", httprouter.Params{{Key: "filepath", Value: "/access-test.mp4"}}
+
+	// Private bookmark can only be read by its account
+	check("private cache", serveBookmarkCache, cachePath, cacheParams, "Private page", []access{
+		{"anonymous", "", "", http.StatusMovedPermanently},
+		{"owner cookie", tokens["alice"], "", http.StatusOK},
+		{"owner header", "", tokens["alice"], http.StatusOK},
+		{"other account", tokens["bob"], "", http.StatusNotFound},
+		{"invalid cookie", "invalid", "", http.StatusMovedPermanently},
+	})
+	check("private video", serveVideo, videoPath, videoParams, "video data", []access{
+		{"anonymous", "", "", http.StatusUnauthorized},
+		{"owner cookie", tokens["alice"], "", http.StatusOK},
+		{"other account", "", tokens["bob"], http.StatusNotFound},
+	})
+
+	missingVideoParams := httprouter.Params{{Key: "filepath", Value: "/../shiori_test.db"}}
+	check("unknown video", serveVideo, "/videos/missing.mp4", missingVideoParams, "", []access{
+		{"owner cookie", tokens["alice"], "", http.StatusNotFound},
+	})
+
+	// Only the file named in database is served, not another file with the same base name
+	if _, err = DB.CreateVideo(book.ID, model.Video{Filename: "nested/access-test.mp4", Downloaded: true}); err != nil {
+		t.Fatalf("failed to create testing video: %v", err)
+	}
+	for _, path := range []string{"/nested/access-test.mp4", "/..", "/"} {
+		check("video path "+path, serveVideo, "/videos"+path, httprouter.Params{{Key: "filepath", Value: path}}, "", []access{
+			{"owner cookie", tokens["alice"], "", http.StatusNotFound},
+		})
+	}
+
+	// Only the owner can share bookmark, and every ID must be submitted explicitly
+	share := func(token, body string) int {
+		r := httptest.NewRequest("PUT", "/api/bookmarks/public", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		apiSetBookmarksPublic(w, r, nil)
+		return w.Code
+	}
+
+	if code := share(tokens["alice"], `{"ids":[],"public":true}`); code != http.StatusBadRequest {
+		t.Errorf("expected status %d sharing without IDs, got %d", http.StatusBadRequest, code)
+	}
+	if code := share(tokens["bob"], `{"ids":["`+id+`"],"public":true}`); code != http.StatusOK {
+		t.Errorf("expected status %d sharing bookmark of other account, got %d", http.StatusOK, code)
+	}
+	check("shared by other account", serveBookmarkCache, cachePath, cacheParams, "", []access{
+		{"anonymous", "", "", http.StatusMovedPermanently},
+	})
+
+	if code := share(tokens["alice"], `{"ids":["`+id+`"],"public":true}`); code != http.StatusOK {
+		t.Errorf("expected status %d sharing bookmark, got %d", http.StatusOK, code)
+	}
+
+	// Public bookmark can be read by anyone
+	check("public cache", serveBookmarkCache, cachePath, cacheParams, "Private page", []access{
+		{"anonymous", "", "", http.StatusOK},
+		{"other account", tokens["bob"], "", http.StatusOK},
+	})
+	check("public video", serveVideo, videoPath, videoParams, "video data", []access{
+		{"anonymous", "", "", http.StatusOK},
+	})
+
+	// Stop sharing from command line
+	if n, err := DB.SetBookmarksPublic(false); err != nil || n != 1 {
+		t.Errorf("expected 1 bookmark no longer shared, got %d (%v)", n, err)
+	}
+	check("unshared cache", serveBookmarkCache, cachePath, cacheParams, "", []access{
+		{"anonymous", "", "", http.StatusMovedPermanently},
+	})
+
+	// Video downloaded once is shared by bookmarks of the same video in every account
+	bob, _ := findAccount("bob")
+	bobBook, err := addBookmark(DB.ForAccount(bob.ID), model.Bookmark{URL: "https://example.com/same-video", Title: "Same video"}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+	if _, err = DB.CreateVideo(bobBook.ID, model.Video{Filename: "access-test.mp4", Downloaded: true}); err != nil {
+		t.Fatalf("failed to create testing video: %v", err)
+	}
+	check("video of two accounts", serveVideo, videoPath, videoParams, "video data", []access{
+		{"anonymous", "", "", http.StatusUnauthorized},
+		{"first owner", tokens["alice"], "", http.StatusOK},
+		{"second owner", "", tokens["bob"], http.StatusOK},
+	})
+}
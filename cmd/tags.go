@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagsCmd = &cobra.Command{
+		Use:   "tags",
+		Short: "Manage the tags of bookmarks",
+		Long: "Manage the tags of bookmarks. Tags can be hierarchical, with their parents separated by slash, " +
+			"e.g. tag dev/go/testing is child of dev/go, which is child of dev.",
+	}
+
+	listTagsCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "Print the saved tags and count of their bookmarks",
+		Aliases: []string{"print", "ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			useJSON, _ := cmd.Flags().GetBool("json")
+			err := printTags(useJSON, os.Stdout)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+
+	renameTagCmd = &cobra.Command{
+		Use:         "rename old-name new-name",
+		Annotations: map[string]string{annotationNeedsAccount: "true"},
+		Short:       "Rename a tag in all bookmarks",
+		Long: "Rename a tag in all bookmarks. The child tags are moved along with it, " +
+			"so renaming dev/go to lang/go also renames dev/go/testing to lang/go/testing.",
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := renameTag(args[0], args[1])
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Println("Tag has been renamed")
+		},
+	}
+
+	mergeTagsCmd = &cobra.Command{
+		Use:         "merge target source...",
+		Annotations: map[string]string{annotationNeedsAccount: "true"},
+		Short:       "Merge tags into the target tag",
+		Long: "Replace the source tags with the target tag in all bookmarks, then remove the source tags. " +
+			"If the target tag doesn't exist yet, it will be created.",
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := mergeTags(args[0], args[1:]...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Println("Tags have been merged")
+		},
+	}
+
+	deleteTagsCmd = &cobra.Command{
+		Use:         "delete name...",
+		Annotations: map[string]string{annotationNeedsAccount: "true"},
+		Short:       "Delete tags and remove them from all bookmarks",
+		Long:        "Delete tags and remove them from all bookmarks, along with their child tags.",
+		Args:        cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			tags, err := findTags(args...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			ids := []int64{}
+			for _, tag := range tags {
+				ids = append(ids, tag.ID)
+			}
+
+			err = DB.DeleteTags(ids...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			if len(args) == 1 {
+				fmt.Println("Tag has been deleted")
+				return
+			}
+			fmt.Println("Tags have been deleted")
+		},
+	}
+
+	pruneTagsCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete tags that are not used by any bookmark",
+		Long: "Delete tags that are not used by any bookmark. " +
+			"Tags of bookmarks in trash are kept, so they are still there when the bookmarks are restored. " +
+			"Parent tags are kept as long as any of their child tags is kept.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			nPruned, err := DB.PruneTags()
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d unused tag(s) deleted\n", nPruned)
+		},
+	}
+)
+
+func init() {
+	listTagsCmd.Flags().BoolP("json", "j", false, "Output data in JSON format")
+
+	tagsCmd.AddCommand(listTagsCmd)
+	tagsCmd.AddCommand(renameTagCmd)
+	tagsCmd.AddCommand(mergeTagsCmd)
+	tagsCmd.AddCommand(deleteTagsCmd)
+	tagsCmd.AddCommand(pruneTagsCmd)
+	rootCmd.AddCommand(tagsCmd)
+}
+
+func printTags(useJSON bool, wr io.Writer) error {
+	tags, err := DB.GetTags()
+	if err != nil {
+		return err
+	}
+
+	if useJSON {
+		bt, err := json.MarshalIndent(&tags, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(wr, string(bt))
+		return nil
+	}
+
+	if len(tags) == 0 {
+		return database.NewError(database.ErrNotFound, "No tags saved yet")
+	}
+
+	for _, tag := range tags {
+		cIndex.Fprint(wr, "- ")
+		cTag.Fprint(wr, tag.Name)
+		fmt.Fprintf(wr, " (%d)\n", tag.NBookmarks)
+	}
+
+	return nil
+}
+
+// findTags looks for the saved tags with the specified names.
+func findTags(names ...string) ([]model.Tag, error) {
+	tags, err := DB.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	tagByName := map[string]model.Tag{}
+	for _, tag := range tags {
+		tagByName[tag.Name] = tag
+	}
+
+	result := []model.Tag{}
+	for _, name := range names {
+		name = database.NormalizeTagName(name)
+		tag, exist := tagByName[name]
+		if !exist {
+			return nil, database.NewError(database.ErrNotFound, fmt.Sprintf("Tag %s doesn't exist", name))
+		}
+
+		result = append(result, tag)
+	}
+
+	return result, nil
+}
+
+func renameTag(oldName, newName string) error {
+	tags, err := findTags(oldName)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.RenameTag(tags[0].ID, newName)
+	return err
+}
+
+func mergeTags(targetName string, sourceNames ...string) error {
+	sources, err := findTags(sourceNames...)
+	if err != nil {
+		return err
+	}
+
+	// If the target doesn't exist, the first source becomes the target
+	targets, err := findTags(targetName)
+	if errors.Is(err, database.ErrNotFound) {
+		target, err := DB.RenameTag(sources[0].ID, targetName)
+		if err != nil {
+			return err
+		}
+		targets, sources = []model.Tag{target}, sources[1:]
+	} else if err != nil {
+		return err
+	}
+
+	sourceIDs := []int64{}
+	for _, source := range sources {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+
+	return DB.MergeTags(targets[0].ID, sourceIDs...)
+}
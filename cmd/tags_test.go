@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	db "github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+)
+
+func TestManageTags(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	testbks := []model.Bookmark{
+		{
+			URL:   "https://example.com/tags/1",
+			Title: "First",
+			Tags:  []model.Tag{{Name: "golang"}, {Name: "go"}},
+		},
+		{
+			URL:   "https://example.com/tags/2",
+			Title: "Second",
+			Tags:  []model.Tag{{Name: "go-lang"}, {Name: "old"}},
+		},
+	}
+	for _, book := range testbks {
+		if _, err := DB.CreateBookmark(book); err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		action func() error
+		want   string
+	}{
+		{func() error { return renameTag("missing", "other") }, "doesn't exist"},
+		{func() error { return renameTag("golang", "go") }, "already exists"},
+		{func() error { return renameTag("old", " ") }, "must not be empty"},
+		{func() error { return renameTag("old", "Legacy") }, ""},
+		{func() error { return mergeTags("go", "golang", "go-lang") }, ""},
+		{func() error { return mergeTags("lang", "legacy") }, ""},
+		{func() error { return mergeTags("go", "missing") }, "doesn't exist"},
+	}
+	for _, tt := range tests {
+		err := tt.action()
+		if err != nil {
+			if tt.want == "" {
+				t.Errorf("got unexpected error: %v", err)
+			} else if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing '%s', got error '%v'", tt.want, err)
+			}
+			continue
+		}
+		if tt.want != "" {
+			t.Errorf("expected error '%s', got no error", tt.want)
+		}
+	}
+
+	// Both bookmarks now use "go", while "legacy" was renamed into "lang"
+	b := bytes.NewBufferString("")
+	if err := printTags(false, b); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got := b.String()
+	if !strings.Contains(got, "go (2)") || !strings.Contains(got, "lang (1)") ||
+		strings.Contains(got, "golang") || strings.Contains(got, "legacy") {
+		t.Errorf("unexpected tags after merge: '%s'", got)
+	}
+
+	// Deleted tag is removed from bookmarks, while tags of bookmarks in trash survive pruning
+	tags, err := findTags("lang")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err = DB.DeleteTags(tags[0].ID); err != nil {
+		t.Fatalf("failed to delete tag: %v", err)
+	}
+
+	if err = DB.DeleteBookmarks(); err != nil {
+		t.Fatalf("failed to delete bookmarks: %v", err)
+	}
+	if nPruned, err := DB.PruneTags(); err != nil || nPruned != 0 {
+		t.Errorf("expected tags in trash to be kept, got %d pruned (%v)", nPruned, err)
+	}
+
+	if _, err = DB.RestoreBookmarks(); err != nil {
+		t.Fatalf("failed to restore bookmarks: %v", err)
+	}
+	bookmarks, err := DB.GetBookmarks(false, db.Page{})
+	if err != nil || len(bookmarks) != 2 || len(bookmarks[1].Tags) != 1 || bookmarks[1].Tags[0].Name != "go" {
+		t.Errorf("expected restored bookmarks with tag go, got %+v (%v)", bookmarks, err)
+	}
+}
+
+func TestHierarchicalTags(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	testbks := []model.Bookmark{
+		{
+			URL:   "https://example.com/tree/1",
+			Title: "Testing",
+			Tags:  []model.Tag{{Name: "Dev/Go/Testing"}},
+		},
+		{
+			URL:   "https://example.com/tree/2",
+			Title: "Go",
+			Tags:  []model.Tag{{Name: "dev/go"}},
+		},
+		{
+			URL:   "https://example.com/tree/3",
+			Title: "Rust",
+			Tags:  []model.Tag{{Name: " dev / rust "}},
+		},
+	}
+	for _, book := range testbks {
+		if _, err := DB.CreateBookmark(book); err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	// The ancestors are created with their parent links
+	tags, err := findTags("dev", "dev/go", "dev/go/testing", "dev/rust")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if tags[0].ParentID != 0 || tags[1].ParentID != tags[0].ID ||
+		tags[2].ParentID != tags[1].ID || tags[3].ParentID != tags[0].ID {
+		t.Errorf("unexpected parent links: %+v", tags)
+	}
+
+	// Names are normalized the same way as when they're saved
+	tags, err = findTags("Dev / Go", "dev//go/")
+	if err != nil || tags[0].Name != "dev/go" || tags[1].Name != "dev/go" {
+		t.Errorf("expected dev/go tags, got %+v (%v)", tags, err)
+	}
+
+	// Searching the parent matches its descendants, but not the tags sharing its prefix
+	searchTitles := func(tag string) string {
+		bookmarks, _, err := DB.SearchBookmarks(db.SortTitle, db.Page{}, db.Query{}.WithTags(tag))
+		if err != nil {
+			t.Fatalf("failed to search %s: %v", tag, err)
+		}
+
+		titles := []string{}
+		for _, book := range bookmarks {
+			titles = append(titles, book.Title)
+		}
+		return strings.Join(titles, ",")
+	}
+
+	for tag, want := range map[string]string{
+		"dev":            "Go,Rust,Testing",
+		"dev/go":         "Go,Testing",
+		"dev/go/testing": "Testing",
+		"dev/g":          "",
+	} {
+		if got := searchTitles(tag); got != want {
+			t.Errorf("search %s: expected %q, got %q", tag, want, got)
+		}
+	}
+
+	// Renaming moves the descendants along with the tag
+	if err = renameTag("dev/go", "lang/go"); err != nil {
+		t.Fatalf("failed to rename tag: %v", err)
+	}
+	if got := searchTitles("lang"); got != "Go,Testing" {
+		t.Errorf("expected renamed tags under lang, got %q", got)
+	}
+	if err = renameTag("lang", "lang/go/old"); err == nil || !strings.Contains(err.Error(), "own child") {
+		t.Errorf("expected error moving tag into its child, got %v", err)
+	}
+	if err = mergeTags("dev", "lang/go"); err == nil || !strings.Contains(err.Error(), "child tags") {
+		t.Errorf("expected error merging tag with children, got %v", err)
+	}
+
+	// Pruning keeps the unused parent of used tags, deleting removes the descendants
+	if nPruned, err := DB.PruneTags(); err != nil || nPruned != 0 {
+		t.Errorf("expected no pruned tags, got %d (%v)", nPruned, err)
+	}
+
+	tags, err = findTags("lang")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if err = DB.DeleteTags(tags[0].ID); err != nil {
+		t.Fatalf("failed to delete tag: %v", err)
+	}
+	if got := searchTitles("lang/go/testing"); got != "" {
+		t.Errorf("expected descendants to be deleted, got %q", got)
+	}
+
+	if err = DB.DeleteTags(tags[0].ID); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected not found error deleting tag twice, got %v", err)
+	}
+}
+
+func TestTagsOfSeveralAccounts(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	// Commands replace DB with the one limited to their account
+	rootDB := DB
+	defer func() { DB = rootDB }()
+
+	accountDB := map[string]db.Database{}
+	for _, username := range []string{"alice", "bob"} {
+		if err := addAccount(username, "fooBar123", ""); err != nil {
+			t.Fatalf("failed to add test account: %v", err)
+		}
+
+		account, _ := findAccount(username)
+		accountDB[username] = DB.ForAccount(account.ID)
+		book := model.Bookmark{URL: "http://127.0.0.1:1/" + username, Title: username, Tags: []model.Tag{{Name: "work"}}}
+		if _, err := addBookmark(accountDB[username], book, true); err != nil {
+			t.Fatalf("failed to create testing bookmark: %v", err)
+		}
+	}
+
+	// Tag name alone doesn't tell whose tag to change
+	for _, cmd := range []string{"rename", "merge", "delete"} {
+		subCmd, _, err := rootCmd.Find([]string{"tags", cmd})
+		if err != nil {
+			t.Fatalf("failed to find tags %s command: %v", cmd, err)
+		}
+
+		if _, err = commandAccount("", subCmd.Annotations[annotationNeedsAccount] != ""); !errors.Is(err, db.ErrValidation) {
+			t.Errorf("tags %s: expected validation error without account, got %v", cmd, err)
+		}
+	}
+
+	// Chosen account only changes its own tag
+	os.Setenv("ENV_SHIORI_USER", "bob")
+	defer os.Unsetenv("ENV_SHIORI_USER")
+
+	rootCmd.SetArgs([]string{"tags", "rename", "work", "job"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("failed to run tags command: %v", err)
+	}
+
+	for username, want := range map[string]string{"alice": "work", "bob": "job"} {
+		tags, err := accountDB[username].GetTags()
+		if err != nil || len(tags) != 1 || tags[0].Name != want {
+			t.Errorf("%s: expected tag %s, got %+v (%v)", username, want, tags, err)
+		}
+	}
+}
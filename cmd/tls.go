@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	fp "path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// selfSignedValidity is how long the generated self-signed certificate is valid.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// tokenCookie returns the cookie that keeps login token in browser. Scripts can't read it,
+// and browser doesn't send it with requests made by other sites, so they can't use the login.
+// When the request uses HTTPS, the cookie is only sent over HTTPS.
+func tokenCookie(r *http.Request, tokenString string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     "token",
+		Value:    tokenString,
+		Path:     publicBasePath(r) + "/",
+		Expires:  expires,
+		Secure:   isSecureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// loadTLSFiles returns the certificate and key files used for serving HTTPS.
+// When selfSigned is true, a missing or expired certificate is generated, defaulting
+// to files in home directory. Returns empty strings if TLS is not used.
+func loadTLSFiles(certFile, keyFile string, selfSigned bool) (string, string, error) {
+	if !selfSigned {
+		if (certFile == "") != (keyFile == "") {
+			return "", "", fmt.Errorf("Both TLS certificate and key must be specified")
+		}
+
+		return certFile, keyFile, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+
+		if certFile == "" {
+			certFile = fp.Join(homeDir, ".shiori-cert.pem")
+		}
+
+		if keyFile == "" {
+			keyFile = fp.Join(homeDir, ".shiori-key.pem")
+		}
+	}
+
+	// Reuse the certificate generated earlier, as long as it's still valid
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && time.Now().Add(24*time.Hour).Before(cert.NotAfter) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := generateCertificate(certFile, keyFile, localHosts()); err != nil {
+		return "", "", err
+	}
+
+	logrus.Infoln("Generated self-signed certificate in", certFile)
+	return certFile, keyFile, nil
+}
+
+// generateCertificate creates self-signed certificate for the hosts, which may be
+// host names or IP addresses. The key is only readable by the current user.
+func generateCertificate(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"Shiori"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	if err = ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+	return ioutil.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// localHosts returns the names and addresses this machine can be reached with,
+// so the self-signed certificate works from other devices in LAN.
+func localHosts() []string {
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		hosts = append(hosts, hostname)
+	}
+
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return append(hosts, "127.0.0.1", "::1")
+	}
+
+	for _, address := range addresses {
+		if ipNet, ok := address.(*net.IPNet); ok {
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+
+	return hosts
+}
+
+// redirectToHTTPS redirects every plain HTTP request to the same URL in HTTPS port.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shiori-tls")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without certificate, TLS is not used
+	if cert, key, err := loadTLSFiles("", "", false); err != nil || cert != "" || key != "" {
+		t.Errorf("expected no TLS files, got %q, %q (%v)", cert, key, err)
+	}
+	if _, _, err = loadTLSFiles(fp.Join(dir, "cert.pem"), "", false); err == nil {
+		t.Errorf("expected error with certificate but no key")
+	}
+
+	// Self-signed certificate is generated once, then reused
+	certFile, keyFile := fp.Join(dir, "cert.pem"), fp.Join(dir, "key.pem")
+	cert, key, err := loadTLSFiles(certFile, keyFile, true)
+	if err != nil || cert != certFile || key != keyFile {
+		t.Fatalf("expected generated certificate, got %q, %q (%v)", cert, key, err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to load generated certificate: %v", err)
+	}
+
+	parsed, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse generated certificate: %v", err)
+	}
+	if err = parsed.VerifyHostname("localhost"); err != nil {
+		t.Errorf("expected certificate for localhost: %v", err)
+	}
+
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected key only readable by owner, got %v (%v)", info.Mode(), err)
+	}
+
+	generated, _ := ioutil.ReadFile(certFile)
+	if _, _, err = loadTLSFiles(certFile, keyFile, true); err != nil {
+		t.Fatalf("failed to load certificate again: %v", err)
+	}
+	if reused, _ := ioutil.ReadFile(certFile); !bytes.Equal(generated, reused) {
+		t.Errorf("expected valid certificate to be reused")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tt := range []struct {
+		host      string
+		httpsPort int
+		want      string
+	}{
+		{"example.com", 443, "https://example.com/bookmark/1?a=b"},
+		{"example.com:80", 443, "https://example.com/bookmark/1?a=b"},
+		{"192.168.1.5:8081", 8080, "https://192.168.1.5:8080/bookmark/1?a=b"},
+		{"[::1]:80", 443, "https://[::1]/bookmark/1?a=b"},
+		{"[::1]", 8443, "https://[::1]:8443/bookmark/1?a=b"},
+	} {
+		r := httptest.NewRequest("GET", "/bookmark/1?a=b", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsPort).ServeHTTP(w, r)
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s: expected redirect to %s, got %d %s", tt.host, tt.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestTokenCookie(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	loginAttempts = newLoginLimiter()
+	jwtKey = []byte("test-key")
+
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+
+	// Login saves the token in cookie that scripts and other sites can't use
+	r := httptest.NewRequest("POST", "https://example.com/api/login", strings.NewReader(`{"username":"alice","password":"fooBar123"}`))
+	w := httptest.NewRecorder()
+	apiLogin(w, r, nil)
+
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("expected login to set cookie, got %d %v (%s)", w.Code, cookies, w.Body)
+	}
+
+	cookie := cookies[0]
+	if cookie.Name != "token" || cookie.Value != w.Body.String() || !cookie.HttpOnly || !cookie.Secure ||
+		cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("unexpected cookie %+v", cookie)
+	}
+
+	// Cookie is enough to use API from browser
+	r = httptest.NewRequest("GET", "/api/bookmarks", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	apiGetBookmarks(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected cookie to be accepted, got %d (%s)", w.Code, w.Body)
+	}
+
+	// Logout removes cookie and its session
+	r = httptest.NewRequest("POST", "/api/logout", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	apiLogout(w, r, nil)
+
+	cookies = w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].MaxAge >= 0 || cookies[0].Value != "" {
+		t.Errorf("expected logout to remove cookie, got %d %v (%s)", w.Code, cookies, w.Body)
+	}
+
+	r = httptest.NewRequest("GET", "/api/bookmarks", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	apiGetBookmarks(w, r, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d after logout, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
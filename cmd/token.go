@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
+	"github.com/spf13/cobra"
+)
+
+// apiTokenPrefix starts every API token, which tells it apart from login token.
+const apiTokenPrefix = "shiori_"
+
+var (
+	tokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "Manage the API tokens of accounts",
+		Long: "API tokens give scripts and integrations access to API without logging in. " +
+			"Send the token in Authorization header, e.g. \"Authorization: Bearer shiori_...\". " +
+			"Token is valid until it's revoked, and works with the role of its account.",
+	}
+
+	createTokenCmd = &cobra.Command{
+		Use:   "create username name",
+		Short: "Create new API token for account",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			readOnly, _ := cmd.Flags().GetBool("read-only")
+
+			token, err := createAPIToken(args[0], args[1], readOnly)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Println("Token has been created. Save it now, since it can't be shown again :")
+			fmt.Println(token)
+		},
+	}
+
+	listTokensCmd = &cobra.Command{
+		Use:     "list [username]",
+		Short:   "Print the API tokens",
+		Long:    "Print the API tokens of account. If no arguments, tokens of all accounts will be printed.",
+		Aliases: []string{"print", "ls"},
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := printAPITokens(args, os.Stdout)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+		},
+	}
+
+	revokeTokensCmd = &cobra.Command{
+		Use:   "revoke username [ids]",
+		Short: "Revoke the API tokens of account",
+		Long: "Revoke the API tokens of account. " +
+			"Accepts space-separated list of token IDs. " +
+			"If no token IDs, all tokens of the account will be revoked.",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			nRevoked, err := revokeAPITokens(args[0], args[1:]...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d token(s) revoked\n", nRevoked)
+		},
+	}
+)
+
+func init() {
+	createTokenCmd.Flags().BoolP("read-only", "r", false, "Only allow the token to read bookmarks and tags")
+
+	tokenCmd.AddCommand(createTokenCmd)
+	tokenCmd.AddCommand(listTokensCmd)
+	tokenCmd.AddCommand(revokeTokensCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+// createAPIToken creates new API token for the account. Returns the token,
+// which can't be recovered later since only its hash is saved.
+func createAPIToken(username, name string, readOnly bool) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", database.NewError(database.ErrValidation, "Token name must not be empty")
+	}
+
+	account, err := findAccount(username)
+	if err != nil {
+		return "", err
+	}
+
+	randomToken := make([]byte, 32)
+	if _, err = rand.Read(randomToken); err != nil {
+		return "", err
+	}
+
+	token := apiTokenPrefix + hex.EncodeToString(randomToken)
+	_, err = DB.CreateAPIToken(model.APIToken{
+		AccountID: account.ID,
+		Name:      name,
+		Hash:      hashAPIToken(token),
+		ReadOnly:  readOnly,
+		Created:   time.Now().UTC().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// hashAPIToken returns the hash of API token that is saved in database.
+// Token is random enough, so unlike password it doesn't need slow hash.
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// revokeAPITokens removes the API tokens of account with matching IDs, or all of its tokens.
+func revokeAPITokens(username string, strIDs ...string) (int, error) {
+	account, err := findAccount(username)
+	if err != nil {
+		return 0, err
+	}
+
+	ids := []int64{}
+	for _, strID := range strIDs {
+		id, err := strconv.ParseInt(strID, 10, 64)
+		if err != nil || id < 1 {
+			return 0, database.NewError(database.ErrValidation, fmt.Sprintf("Token ID %s is not valid", strID))
+		}
+		ids = append(ids, id)
+	}
+
+	return DB.DeleteAPITokens(account.ID, ids...)
+}
+
+// printAPITokens prints the API tokens of the account in args, or of every account.
+func printAPITokens(args []string, wr io.Writer) error {
+	accountID := int64(0)
+	if len(args) > 0 {
+		account, err := findAccount(args[0])
+		if err != nil {
+			return err
+		}
+		accountID = account.ID
+	}
+
+	tokens, err := DB.GetAPITokens(accountID)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return fmt.Errorf("No API tokens")
+	}
+
+	for _, token := range tokens {
+		scope := "read and write"
+		if token.ReadOnly {
+			scope = "read only"
+		}
+
+		lastUsed := "never used"
+		if token.LastUsed != "" {
+			lastUsed = "last used at " + token.LastUsed
+		}
+
+		cIndex.Fprintf(wr, "%d. ", token.ID)
+		fmt.Fprint(wr, token.Name)
+		cTag.Fprintf(wr, " (%s, %s)\n", token.Username, scope)
+		fmt.Fprintf(wr, "   Created at %s, %s\n", token.Created, lastUsed)
+	}
+
+	return nil
+}
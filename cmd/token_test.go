@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	db "github.com/s-frostick/shiori/database"
+)
+
+func TestAPITokens(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	if err := addAccount("alice", "fooBar123", "editor"); err != nil {
+		t.Fatalf("failed to add test account: %v", err)
+	}
+
+	writeToken, err := createAPIToken("alice", "deploy", false)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	readToken, err := createAPIToken("alice", " feed reader ", true)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	if _, err = createAPIToken("alice", "deploy", true); !errors.Is(err, db.ErrConflict) {
+		t.Errorf("expected conflict error with duplicate name, got %v", err)
+	}
+	if _, err = createAPIToken("alice", " ", true); !errors.Is(err, db.ErrValidation) {
+		t.Errorf("expected validation error with empty name, got %v", err)
+	}
+	if _, err = createAPIToken("nobody", "deploy", true); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("expected not found error with missing account, got %v", err)
+	}
+
+	// Only the hash of token is saved
+	tokens, err := DB.GetAPITokens(0)
+	if err != nil || len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens, got %+v (%v)", tokens, err)
+	}
+	if tokens[0].Name != "deploy" || tokens[1].Name != "feed reader" || !tokens[1].ReadOnly || tokens[1].LastUsed != "" {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+	for _, token := range tokens {
+		if token.Hash == writeToken || token.Hash == readToken {
+			t.Errorf("expected token to be saved hashed, got %s", token.Hash)
+		}
+	}
+
+	// Tokens are accepted by API, limited by their scope
+	request := func(token, method string, handler httprouter.Handle) int {
+		r := httptest.NewRequest(method, "/api/test", strings.NewReader("[]"))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r, nil)
+		return w.Code
+	}
+
+	for _, tt := range []struct {
+		name       string
+		token      string
+		method     string
+		handler    httprouter.Handle
+		wantStatus int
+	}{
+		{"read-only token reads", readToken, "GET", apiGetBookmarks, http.StatusOK},
+		{"read-only token can't write", readToken, "DELETE", apiDeleteBookmarks, http.StatusForbidden},
+		{"read-only token can't change password", readToken, "PUT", apiChangePassword, http.StatusForbidden},
+		{"token writes", writeToken, "DELETE", apiDeleteBookmarks, http.StatusOK},
+		{"token can't exceed role", writeToken, "GET", apiGetAccounts, http.StatusForbidden},
+		{"unknown token", apiTokenPrefix + "unknown", "GET", apiGetBookmarks, http.StatusUnauthorized},
+		{"token can't log out", writeToken, "POST", apiLogout, http.StatusBadRequest},
+	} {
+		if code := request(tt.token, tt.method, tt.handler); code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, code)
+		}
+	}
+
+	// Using token is recorded
+	tokens, err = DB.GetAPITokens(0)
+	if err != nil || len(tokens) != 2 || tokens[0].LastUsed == "" || tokens[1].LastUsed == "" {
+		t.Errorf("expected last used time of tokens, got %+v (%v)", tokens, err)
+	}
+
+	b := bytes.NewBufferString("")
+	if err = printAPITokens([]string{"alice"}, b); err != nil || !strings.Contains(b.String(), "read only") {
+		t.Errorf("expected printed read-only token, got %q (%v)", b.String(), err)
+	}
+
+	// Revoked token is refused
+	if _, err = revokeAPITokens("alice", "abc"); !errors.Is(err, db.ErrValidation) {
+		t.Errorf("expected validation error with invalid ID, got %v", err)
+	}
+
+	n, err := revokeAPITokens("alice", strconv.FormatInt(tokens[1].ID, 10))
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 revoked token, got %d (%v)", n, err)
+	}
+	if code := request(readToken, "GET", apiGetBookmarks); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with revoked token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := request(writeToken, "GET", apiGetBookmarks); code != http.StatusOK {
+		t.Errorf("expected other token to stay valid, got %d", code)
+	}
+}
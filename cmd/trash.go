@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/s-frostick/shiori/database"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trashCmd = &cobra.Command{
+		Use:   "trash",
+		Short: "Manage the deleted bookmarks",
+		Long: "Deleted bookmarks are moved to trash, where they can be restored or removed permanently. " +
+			"If ENV_SHIORI_TRASH_RETENTION is set to number of days, bookmarks that stay " +
+			"in trash longer than that are removed automatically.",
+	}
+
+	listTrashCmd = &cobra.Command{
+		Use:     "list",
+		Short:   "Print the bookmarks in trash",
+		Aliases: []string{"print", "ls"},
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// Read flags
+			useJSON, _ := cmd.Flags().GetBool("json")
+			indexOnly, _ := cmd.Flags().GetBool("index-only")
+
+			page, err := pageFromFlags(cmd)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			// Read bookmarks from database
+			bookmarks, _, err := DB.GetDeletedBookmarks(page)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			if len(bookmarks) == 0 {
+				if page.Offset > 0 {
+					cError.Println("No bookmarks in this page")
+				} else {
+					cError.Println("Trash is empty")
+				}
+
+				return
+			}
+
+			// Print data
+			if useJSON {
+				bt, err := json.MarshalIndent(&bookmarks, "", "    ")
+				if err != nil {
+					cError.Println(err)
+					return
+				}
+				fmt.Println(string(bt))
+			} else if indexOnly {
+				printBookmarkIndex(bookmarks...)
+			} else {
+				printBookmark(bookmarks...)
+			}
+		},
+	}
+
+	restoreTrashCmd = &cobra.Command{
+		Use:   "restore [indices]",
+		Short: "Restore the bookmarks from trash",
+		Long: "Move bookmarks out of trash, keeping their index. " +
+			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
+			"If no arguments, all bookmarks in trash will be restored.",
+		Run: func(cmd *cobra.Command, args []string) {
+			nRestored, err := DB.RestoreBookmarks(args...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			if nRestored == 0 {
+				cError.Println("No matching bookmarks in trash")
+				return
+			}
+
+			fmt.Printf("%d bookmark(s) restored\n", nRestored)
+		},
+	}
+
+	emptyTrashCmd = &cobra.Command{
+		Use:   "empty [indices]",
+		Short: "Remove the bookmarks in trash permanently",
+		Long: "Remove bookmarks in trash permanently, including their tags, content and the downloaded video " +
+			"that no other bookmark uses. " +
+			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
+			"If no arguments, all bookmarks in trash will be removed.",
+		Run: func(cmd *cobra.Command, args []string) {
+			// Read flags
+			skipConfirmation, _ := cmd.Flags().GetBool("yes")
+
+			// If no arguments, confirm to user
+			if len(args) == 0 && !skipConfirmation {
+				confirmEmpty := ""
+				fmt.Print("Remove ALL bookmarks in trash permanently? (y/n): ")
+				fmt.Scanln(&confirmEmpty)
+
+				if confirmEmpty != "y" {
+					fmt.Println("No bookmarks removed")
+					return
+				}
+			}
+
+			nPurged, err := purgeBookmarks(DB, time.Time{}, args...)
+			if err != nil {
+				cError.Println(err)
+				return
+			}
+
+			fmt.Printf("%d bookmark(s) removed permanently\n", nPurged)
+		},
+	}
+)
+
+func init() {
+	listTrashCmd.Flags().BoolP("json", "j", false, "Output data in JSON format")
+	listTrashCmd.Flags().BoolP("index-only", "i", false, "Only print the index of bookmarks")
+	listTrashCmd.Flags().IntP("limit", "l", 0, "Maximum number of bookmarks to print, 0 means no limit")
+	listTrashCmd.Flags().IntP("page", "p", 1, "Page of bookmarks to print, used together with --limit")
+	emptyTrashCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and remove ALL bookmarks in trash")
+
+	trashCmd.AddCommand(listTrashCmd)
+	trashCmd.AddCommand(restoreTrashCmd)
+	trashCmd.AddCommand(emptyTrashCmd)
+	rootCmd.AddCommand(trashCmd)
+}
+
+// trashRetention reads how long bookmarks are kept in trash from ENV_SHIORI_TRASH_RETENTION,
+// which is number of days. Zero means they are kept until the trash is emptied.
+func trashRetention() (time.Duration, error) {
+	value, found := os.LookupEnv("ENV_SHIORI_TRASH_RETENTION")
+	if !found || value == "" {
+		return 0, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("ENV_SHIORI_TRASH_RETENTION must be number of days, got %q", value)
+	}
+
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// purgeExpiredTrash permanently removes bookmarks that have been in trash longer than
+// retention. The retention applies to every account, not only the one chosen by --user.
+func purgeExpiredTrash(retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	return purgeBookmarks(DB.ForAccount(0), time.Now().Add(-retention))
+}
+
+// purgeBookmarks permanently removes bookmarks in trash like PurgeBookmarks of db,
+// along with the downloaded videos that aren't used by any bookmark anymore.
+func purgeBookmarks(db database.Database, deletedBefore time.Time, indices ...string) (int, error) {
+	nPurged, err := db.PurgeBookmarks(deletedBefore, indices...)
+	if err != nil || nPurged == 0 {
+		return nPurged, err
+	}
+
+	filenames, err := db.DeleteUnusedVideos()
+	if err != nil {
+		return nPurged, err
+	}
+
+	for _, filename := range filenames {
+		err = os.Remove(fp.Join("videos", fp.Base(filename)))
+		if err != nil && !os.IsNotExist(err) {
+			return nPurged, err
+		}
+	}
+
+	return nPurged, nil
+}
+
+// purgeTrashPeriodically runs purgeExpiredTrash every hour, so long running
+// server also removes the expired bookmarks. It stops when ctx is done.
+func purgeTrashPeriodically(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		nPurged, err := purgeExpiredTrash(retention)
+		if err != nil {
+			logrus.Errorln("Failed to purge trash:", err)
+			continue
+		}
+
+		if nPurged > 0 {
+			logrus.Infoln("Purged", nPurged, "expired bookmark(s) from trash")
+		}
+	}
+}
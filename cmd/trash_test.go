@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/s-frostick/shiori/model"
+)
+
+func TestPurgeBookmarksVideos(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	if _, err := os.Stat("videos"); os.IsNotExist(err) {
+		if err = os.Mkdir("videos", 0755); err != nil {
+			t.Fatalf("failed to create videos directory: %v", err)
+		}
+		defer os.RemoveAll("videos")
+	}
+
+	// Both bookmarks use the same downloaded file
+	ids := []string{}
+	for _, url := range []string{"http://127.0.0.1:1/first", "http://127.0.0.1:1/second"} {
+		book, err := addBookmark(DB, model.Bookmark{URL: url, Title: "Video"}, true)
+		if err != nil {
+			t.Fatalf("failed to create testing bookmark: %v", err)
+		}
+		if _, err = DB.CreateVideo(book.ID, model.Video{Filename: "purge-test.mp4", Downloaded: true}); err != nil {
+			t.Fatalf("failed to create testing video: %v", err)
+		}
+		ids = append(ids, strconv.FormatInt(book.ID, 10))
+	}
+
+	if err := ioutil.WriteFile("videos/purge-test.mp4", []byte("video data"), 0644); err != nil {
+		t.Fatalf("failed to create testing video: %v", err)
+	}
+	defer os.Remove("videos/purge-test.mp4")
+
+	if err := DB.DeleteBookmarks(); err != nil {
+		t.Fatalf("failed to delete bookmarks: %v", err)
+	}
+
+	// File is kept while any bookmark still uses it
+	for i, wantExist := range []bool{true, false} {
+		if n, err := purgeBookmarks(DB, time.Time{}, ids[i]); err != nil || n != 1 {
+			t.Fatalf("expected 1 purged bookmark, got %d (%v)", n, err)
+		}
+
+		_, err := os.Stat("videos/purge-test.mp4")
+		if exist := err == nil; exist != wantExist {
+			t.Errorf("purging bookmark %s: expected file to exist %v, got %v", ids[i], wantExist, exist)
+		}
+	}
+}
@@ -9,8 +9,9 @@ import (
 	"time"
 
 	"github.com/RadhiFadlillah/go-readability"
-	"github.com/s-frostick/shiori/model"
 	"github.com/gosuri/uiprogress"
+	"github.com/s-frostick/shiori/database"
+	"github.com/s-frostick/shiori/model"
 	"github.com/spf13/cobra"
 )
 
@@ -21,14 +22,12 @@ var (
 		Long: "Update fields of an existing bookmark. " +
 			"Accepts space-separated list of indices (e.g. 5 6 23 4 110 45), hyphenated range (e.g. 100-200) or both (e.g. 1-3 7 9). " +
 			"If no arguments, ALL bookmarks will be updated. Update works differently depending on the flags:\n" +
-			"- If indices are passed without any flags (--url, --title, --tag and --excerpt), read the URLs from DB and update titles from web.\n" +
+			"- If indices are passed without any flags (--url, --title, --excerpt, --author, --image and --tags), read the URLs from DB and update titles from web.\n" +
 			"- If --url is passed (and --title is omitted), update the title from web using the URL. While using this flag, update only accept EXACTLY one index.\n" +
+			"- Fields whose flag is passed are set to its value, even if it's empty (e.g. --excerpt \"\" clears the excerpt). The other fields are left alone.\n" +
 			"While updating bookmark's tags, you can use - to remove tag (e.g. -nature to remove nature tag from this bookmark).",
 		Run: func(cmd *cobra.Command, args []string) {
 			// Read flags
-			url, _ := cmd.Flags().GetString("url")
-			title, _ := cmd.Flags().GetString("title")
-			excerpt, _ := cmd.Flags().GetString("excerpt")
 			tags, _ := cmd.Flags().GetStringSlice("tags")
 			offline, _ := cmd.Flags().GetBool("offline")
 			skipConfirmation, _ := cmd.Flags().GetBool("yes")
@@ -48,11 +47,6 @@ var (
 				}
 			}
 
-			// Check if --excerpt flag is used
-			if !cmd.Flags().Changed("excerpt") {
-				excerpt = "empty"
-			}
-
 			// If no arguments, confirm to user
 			if len(args) == 0 && !skipConfirmation {
 				confirmUpdate := ""
@@ -65,19 +59,17 @@ var (
 				}
 			}
 
-			// Update bookmarks
-			base := model.Bookmark{
-				URL:     url,
-				Title:   title,
-				Excerpt: excerpt,
-			}
-
-			base.Tags = make([]model.Tag, len(tags))
-			for i, tag := range tags {
-				base.Tags[i] = model.Tag{Name: tag}
+			// Only change the fields whose flag is used, so empty value clears the field
+			patch := model.BookmarkPatch{
+				URL:      changedString(cmd, "url"),
+				Title:    changedString(cmd, "title"),
+				Excerpt:  changedString(cmd, "excerpt"),
+				Author:   changedString(cmd, "author"),
+				ImageURL: changedString(cmd, "image"),
 			}
 
-			bookmarks, err := updateBookmarks(args, base, offline, overwriteMetadata)
+			// Update bookmarks
+			bookmarks, err := updateBookmarks(DB, args, patch, tags, offline, overwriteMetadata, printFetchProgress())
 			if err != nil {
 				cError.Println(err)
 				return
@@ -92,58 +84,105 @@ func init() {
 	updateCmd.Flags().StringP("url", "u", "", "New URL for this bookmark.")
 	updateCmd.Flags().StringP("title", "i", "", "New title for this bookmark.")
 	updateCmd.Flags().StringP("excerpt", "e", "", "New excerpt for this bookmark.")
+	updateCmd.Flags().String("author", "", "New author for this bookmark.")
+	updateCmd.Flags().String("image", "", "New URL of image for this bookmark.")
 	updateCmd.Flags().StringSliceP("tags", "t", []string{}, "Comma-separated tags for this bookmark.")
 	updateCmd.Flags().BoolP("offline", "o", false, "Update bookmark without fetching data from internet.")
 	updateCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt and update ALL bookmarks")
-	updateCmd.Flags().Bool("dont-overwrite", false, "Don't overwrite existing metadata. Useful when only want to update bookmark's content.")
+	updateCmd.Flags().Bool("dont-overwrite", false, "Don't overwrite existing title and excerpt with the ones from web. Useful when only want to update bookmark's content.")
 	rootCmd.AddCommand(updateCmd)
 }
 
-func updateBookmarks(indices []string, base model.Bookmark, offline, overwrite bool) ([]model.Bookmark, error) {
-	// Prepare wait group
-	waitGroup := sync.WaitGroup{}
+// changedString returns the value of string flag, or nil if the flag isn't used.
+func changedString(cmd *cobra.Command, name string) *string {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
 
-	// Check if URL is not empty
-	if base.URL != "" {
-		// Make sure URL valid
-		parsedURL, err := nurl.ParseRequestURI(base.URL)
-		if err != nil || parsedURL.Host == "" {
-			return []model.Bookmark{}, fmt.Errorf("URL is not valid")
+	value, _ := cmd.Flags().GetString(name)
+	return &value
+}
+
+// fetchProgress is told how many bookmarks have been fetched from internet so far,
+// starting with none before the first one is fetched.
+type fetchProgress func(fetched, total int)
+
+// printFetchProgress returns fetchProgress that shows progress bar in terminal.
+func printFetchProgress() fetchProgress {
+	var bar *uiprogress.Bar
+	return func(fetched, total int) {
+		if fetched == 0 {
+			fmt.Println("Fetching new bookmarks data")
+			uiprogress.Start()
+			bar = uiprogress.AddBar(total).AppendCompleted().PrependElapsed()
+			return
 		}
 
-		// Clear UTM parameters from URL
-		base.URL, err = clearUTMParams(parsedURL)
-		if err != nil {
-			return []model.Bookmark{}, err
+		bar.Incr()
+		if fetched == total {
+			// Give the bar time to show it's completed
+			time.Sleep(1 * time.Second)
+			uiprogress.Stop()
+			fmt.Println("\nSaving new data")
 		}
 	}
+}
+
+// updateBookmarks fetches bookmarks with matching indices from internet again unless offline, then
+// applies the patch to them. Title and excerpt from internet are only used if overwrite is true.
+// Tags in tagChanges are added to every bookmark, or removed if prefixed with - (e.g. -nature).
+// Progress of fetching is reported to progress, unless it's nil.
+func updateBookmarks(db database.Database, indices []string, patch model.BookmarkPatch, tagChanges []string, offline, overwrite bool, progress fetchProgress) ([]model.Bookmark, error) {
+	// Prepare wait group, and mutex so progress is reported one at a time
+	waitGroup := sync.WaitGroup{}
+	progressMutex := sync.Mutex{}
+	fetched := 0
+
+	// Make sure patch is valid before fetching anything
+	_, err := applyBookmarkPatch(model.Bookmark{}, patch)
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
 
 	// Read bookmarks from database
-	bookmarks, err := DB.GetBookmarks(true, indices...)
+	bookmarks, err := db.GetBookmarks(true, database.Page{}, indices...)
 	if err != nil {
 		return []model.Bookmark{}, err
 	}
 
 	if len(bookmarks) == 0 {
-		return []model.Bookmark{}, fmt.Errorf("No matching index found")
+		return []model.Bookmark{}, database.NewError(database.ErrNotFound, "No matching index found")
 	}
 
-	if base.URL != "" && len(bookmarks) == 1 {
-		bookmarks[0].URL = base.URL
+	// New URL is the one to fetch, so it's changed first
+	if patch.URL != nil {
+		if len(bookmarks) != 1 {
+			return []model.Bookmark{}, database.NewError(database.ErrValidation, "URL can only be changed in one bookmark")
+		}
+
+		bookmarks[0], err = applyBookmarkPatch(bookmarks[0], model.BookmarkPatch{URL: patch.URL})
+		if err != nil {
+			return []model.Bookmark{}, err
+		}
 	}
 
 	// If not offline, fetch articles from internet
 	if !offline {
-		fmt.Println("Fetching new bookmarks data")
-		uiprogress.Start()
-		bar := uiprogress.AddBar(len(bookmarks)).AppendCompleted().PrependElapsed()
+		if progress != nil {
+			progress(0, len(bookmarks))
+		}
 
 		for i, book := range bookmarks {
 			waitGroup.Add(1)
 
 			go func(pos int, book model.Bookmark) {
 				defer func() {
-					bar.Incr()
+					if progress != nil {
+						progressMutex.Lock()
+						fetched++
+						progress(fetched, len(bookmarks))
+						progressMutex.Unlock()
+					}
 					waitGroup.Done()
 				}()
 
@@ -162,76 +201,154 @@ func updateBookmarks(indices []string, base model.Bookmark, offline, overwrite b
 				book.MinReadTime = article.Meta.MinReadTime
 				book.MaxReadTime = article.Meta.MaxReadTime
 				book.Content = article.Content
-                if !book.IsVideo  {
-				    book.HTML = article.RawContent
-                }
+				if !book.IsVideo {
+					book.HTML = article.RawContent
+				}
 
 				bookmarks[pos] = book
 			}(i, book)
 		}
 
-		time.Sleep(1 * time.Second)
 		waitGroup.Wait()
+	}
+
+	// Change the fields in patch, which win over the ones from internet
+	for i := range bookmarks {
+		bookmarks[i], err = applyBookmarkPatch(bookmarks[i], patch)
+		if err != nil {
+			return []model.Bookmark{}, err
+		}
+
+		bookmarks[i].Tags = changeTags(bookmarks[i].Tags, tagChanges)
+		bookmarks[i].HTML = sanitizeHTML(bookmarks[i].HTML)
+		bookmarks[i].Modified = time.Now().UTC().Format("2006-01-02 15:04:05")
+	}
 
-		uiprogress.Stop()
-		fmt.Println("\nSaving new data")
+	result, err := db.UpdateBookmarks(bookmarks)
+	if err != nil {
+		return []model.Bookmark{}, fmt.Errorf("Failed to update bookmarks: %w", err)
 	}
 
-	// Map the tags to be deleted
-	addedTags := make(map[string]struct{})
-	deletedTags := make(map[string]struct{})
-	for _, tag := range base.Tags {
-		tagName := strings.ToLower(tag.Name)
-		tagName = strings.TrimSpace(tagName)
+	// Share or stop sharing bookmarks if asked
+	if patch.Public != nil {
+		ids := []string{}
+		for i := range result {
+			ids = append(ids, strconv.FormatInt(result[i].ID, 10))
+			result[i].Public = *patch.Public
+		}
 
-		if strings.HasPrefix(tagName, "-") {
-			tagName = strings.TrimPrefix(tagName, "-")
-			deletedTags[tagName] = struct{}{}
-		} else {
-			addedTags[tagName] = struct{}{}
+		_, err = db.SetBookmarksPublic(*patch.Public, ids...)
+		if err != nil {
+			return []model.Bookmark{}, fmt.Errorf("Failed to update bookmarks: %w", err)
 		}
 	}
 
-	// Set default title, excerpt and tags
-	for i := range bookmarks {
-		if base.Title != "" && overwrite {
-			bookmarks[i].Title = base.Title
+	return result, nil
+}
+
+// applyBookmarkPatch returns the bookmark with the fields in patch changed,
+// after making sure the new values are valid.
+func applyBookmarkPatch(book model.Bookmark, patch model.BookmarkPatch) (model.Bookmark, error) {
+	if patch.URL != nil {
+		parsedURL, err := nurl.ParseRequestURI(*patch.URL)
+		if err != nil || parsedURL.Host == "" {
+			return book, database.NewError(database.ErrValidation, "URL is not valid")
 		}
 
-		if base.Excerpt != "empty" && overwrite {
-			bookmarks[i].Excerpt = base.Excerpt
+		// Clear UTM parameters from URL
+		book.URL, err = clearUTMParams(parsedURL)
+		if err != nil {
+			return book, err
 		}
+	}
 
-		tempAddedTags := make(map[string]struct{})
-		for key, value := range addedTags {
-			tempAddedTags[key] = value
+	if patch.Title != nil {
+		book.Title = normalizeSpace(*patch.Title)
+		if book.Title == "" {
+			return book, database.NewError(database.ErrValidation, "Title must not be empty")
 		}
+	}
 
-		newTags := []model.Tag{}
-		for _, tag := range bookmarks[i].Tags {
-			if _, isDeleted := deletedTags[tag.Name]; isDeleted {
-				tag.Deleted = true
-			}
+	if patch.Excerpt != nil {
+		book.Excerpt = strings.TrimSpace(*patch.Excerpt)
+	}
 
-			if _, alreadyExist := addedTags[tag.Name]; alreadyExist {
-				delete(tempAddedTags, tag.Name)
-			}
+	if patch.Author != nil {
+		book.Author = normalizeSpace(*patch.Author)
+	}
 
-			newTags = append(newTags, tag)
+	// Image is shown in web interface, so it must come from web
+	if patch.ImageURL != nil {
+		book.ImageURL = strings.TrimSpace(*patch.ImageURL)
+		if book.ImageURL != "" {
+			parsedURL, err := nurl.ParseRequestURI(book.ImageURL)
+			if err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+				return book, database.NewError(database.ErrValidation, "Image URL is not valid")
+			}
 		}
+	}
 
-		for tag := range tempAddedTags {
-			newTags = append(newTags, model.Tag{Name: tag})
+	if patch.Tags != nil {
+		book.Tags = replaceTags(book.Tags, *patch.Tags)
+	}
+
+	return book, nil
+}
+
+// replaceTags returns the tags to save so bookmark ends up with exactly the wanted tags,
+// i.e. the current tags that aren't wanted are marked as deleted and the new ones are added.
+func replaceTags(current, wanted []model.Tag) []model.Tag {
+	wantedNames := []string{}
+	isWanted := map[string]bool{}
+	for _, tag := range wanted {
+		name := database.NormalizeTagName(tag.Name)
+		if name != "" && !isWanted[name] {
+			wantedNames = append(wantedNames, name)
+			isWanted[name] = true
 		}
+	}
 
-		bookmarks[i].Tags = newTags
-		bookmarks[i].Modified = time.Now().UTC().Format("2006-01-02 15:04:05")
+	result := []model.Tag{}
+	isCurrent := map[string]bool{}
+	for _, tag := range current {
+		tag.Deleted = !isWanted[tag.Name]
+		isCurrent[tag.Name] = true
+		result = append(result, tag)
 	}
 
-	result, err := DB.UpdateBookmarks(bookmarks)
-	if err != nil {
-		return []model.Bookmark{}, fmt.Errorf("Failed to update bookmarks: %v", err)
+	for _, name := range wantedNames {
+		if !isCurrent[name] {
+			result = append(result, model.Tag{Name: name})
+		}
 	}
 
-	return result, nil
+	return result
+}
+
+// changeTags returns the tags to save after adding the tags in changes,
+// or marking them as deleted if prefixed with - (e.g. -nature).
+func changeTags(tags []model.Tag, changes []string) []model.Tag {
+	result := append([]model.Tag{}, tags...)
+	for _, change := range changes {
+		change = strings.TrimSpace(change)
+		deleted := strings.HasPrefix(change, "-")
+		name := database.NormalizeTagName(strings.TrimPrefix(change, "-"))
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for i := range result {
+			if result[i].Name == name {
+				result[i].Deleted = deleted
+				found = true
+			}
+		}
+
+		if !found && !deleted {
+			result = append(result, model.Tag{Name: name})
+		}
+	}
+
+	return result
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
@@ -20,19 +21,17 @@ func TestUpdateBookMark(t *testing.T) {
 		},
 	}
 	for i, tb := range testbks {
-		bk, err := addBookmark(tb, true)
+		bk, err := addBookmark(DB, tb, true)
 		if err != nil {
 			t.Fatalf("failed to create testing bookmarks: %v", err)
 		}
 		testbks[i].ID = bk.ID
 	}
 
+	newTitle := testbks[0].Title + " updated"
 	tests := []struct {
 		indices []string
-		url     string
-		title   string
-		excerpt string
-		tags    []string
+		patch   model.BookmarkPatch
 		offline bool
 		want    string
 	}{
@@ -50,8 +49,7 @@ func TestUpdateBookMark(t *testing.T) {
 		},
 		{
 			indices: []string{fmt.Sprintf("%d", testbks[0].ID)},
-			url:     testbks[0].URL,
-			title:   testbks[0].Title + " updated",
+			patch:   model.BookmarkPatch{URL: &testbks[0].URL, Title: &newTitle},
 			offline: true,
 		},
 		{
@@ -64,18 +62,7 @@ func TestUpdateBookMark(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		base := model.Bookmark{
-			URL:     tt.url,
-			Title:   tt.title,
-			Excerpt: tt.excerpt,
-		}
-
-		base.Tags = make([]model.Tag, len(tt.tags))
-		for i, tag := range tt.tags {
-			base.Tags[i] = model.Tag{Name: tag}
-		}
-
-		bks, err := updateBookmarks(tt.indices, base, tt.offline, true)
+		bks, err := updateBookmarks(DB, tt.indices, tt.patch, nil, tt.offline, true, nil)
 		if err != nil {
 			if tt.want == "" {
 				t.Errorf("got unexpected error: '%v'", err)
@@ -95,8 +82,173 @@ func TestUpdateBookMark(t *testing.T) {
 			continue
 		}
 		bk := bks[0]
-		if tt.title == "" && bk.Title == tt.title {
-			t.Errorf("expected title as '%s', got '%s'", tt.title, bk.Title)
+		if tt.patch.Title != nil && bk.Title != *tt.patch.Title {
+			t.Errorf("expected title as '%s', got '%s'", *tt.patch.Title, bk.Title)
+		}
+	}
+}
+
+func TestUpdateBookmarkPatch(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	book, err := addBookmark(DB, model.Bookmark{
+		URL:     "http://127.0.0.1:1/patch",
+		Title:   "Title",
+		Excerpt: "Excerpt",
+		Author:  "Author",
+		Tags:    []model.Tag{{Name: "go"}, {Name: "news"}},
+	}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+	other, err := addBookmark(DB, model.Bookmark{URL: "http://127.0.0.1:1/other", Title: "Other"}, true)
+	if err != nil {
+		t.Fatalf("failed to create testing bookmark: %v", err)
+	}
+
+	index := fmt.Sprintf("%d", book.ID)
+	both := fmt.Sprintf("%d-%d", book.ID, other.ID)
+	decodePatch := func(s string) model.BookmarkPatch {
+		patch := model.BookmarkPatch{}
+		if err := patch.UnmarshalJSON([]byte(s)); err != nil {
+			t.Fatalf("failed to decode patch %s: %v", s, err)
+		}
+		return patch
+	}
+
+	tagNames := func(book model.Bookmark) string {
+		names := []string{}
+		for _, tag := range book.Tags {
+			if !tag.Deleted {
+				names = append(names, tag.Name)
+			}
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+
+	for _, tt := range []struct {
+		name        string
+		index       string
+		patch       string
+		tagChanges  []string
+		wantErr     string
+		wantTitle   string
+		wantExcerpt string
+		wantAuthor  string
+		wantImage   string
+		wantTags    string
+	}{
+		{"missing field is kept", index, `{"title":"New title"}`, nil, "", "New title", "Excerpt", "Author", "", "go,news"},
+		{"null field is cleared", index, `{"excerpt":null,"author":""}`, nil, "", "New title", "", "", "", "go,news"},
+		{"image is changed", index, `{"imageURL":"https://example.com/a.png"}`, nil, "", "New title", "", "", "https://example.com/a.png", "go,news"},
+		{"tags are replaced", index, `{"tags":[{"name":"Dev/Go"},{"name":"news"}]}`, nil, "", "New title", "", "", "https://example.com/a.png", "dev/go,news"},
+		{"tags are changed", index, `{}`, []string{"-news", "rust"}, "", "New title", "", "", "https://example.com/a.png", "dev/go,rust"},
+		{"null tags are cleared", index, `{"tags":null}`, nil, "", "New title", "", "", "https://example.com/a.png", ""},
+		{"title can't be cleared", index, `{"title":null}`, nil, "Title must not be empty", "", "", "", "", ""},
+		{"image must be from web", index, `{"imageURL":"javascript:alert(1)"}`, nil, "Image URL is not valid", "", "", "", "", ""},
+		{"URL must be valid", index, `{"url":"not a url"}`, nil, "URL is not valid", "", "", "", "", ""},
+		{"URL of one bookmark", both, `{"url":"http://127.0.0.1:1/same"}`, nil, "URL can only be changed in one bookmark", "", "", "", "", ""},
+	} {
+		bookmarks, err := updateBookmarks(DB, []string{tt.index}, decodePatch(tt.patch), tt.tagChanges, true, false, nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		// Check the saved bookmark, not only the returned one
+		saved, err := findBookmark(DB, book.ID, false)
+		if err != nil {
+			t.Fatalf("%s: failed to read bookmark: %v", tt.name, err)
 		}
+
+		for _, bk := range []model.Bookmark{bookmarks[0], saved} {
+			if bk.Title != tt.wantTitle || bk.Excerpt != tt.wantExcerpt || bk.Author != tt.wantAuthor ||
+				bk.ImageURL != tt.wantImage || bk.URL != "http://127.0.0.1:1/patch" {
+				t.Errorf("%s: unexpected bookmark %+v", tt.name, bk)
+			}
+		}
+
+		if tags := tagNames(saved); tags != tt.wantTags {
+			t.Errorf("%s: expected tags %s, got %s", tt.name, tt.wantTags, tags)
+		}
+	}
+}
+
+func TestBookmarkPatchJSON(t *testing.T) {
+	for _, tt := range []struct {
+		json    string
+		wantErr bool
+	}{
+		{`{}`, false},
+		{`{"url":"https://example.com","title":"Title","excerpt":null,"author":"","imageURL":null,"tags":[],"public":true}`, false},
+		{`{"titel":"Typo"}`, true},
+		{`{"id":5}`, true},
+		{`{"title":5}`, true},
+		{`{"tags":"go"}`, true},
+		{`[]`, true},
+	} {
+		patch := model.BookmarkPatch{}
+		err := patch.UnmarshalJSON([]byte(tt.json))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.json, tt.wantErr, err)
+		}
+	}
+
+	// Missing field stays nil, while null field becomes empty value
+	patch := model.BookmarkPatch{}
+	if err := patch.UnmarshalJSON([]byte(`{"excerpt":null,"tags":null}`)); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+
+	if patch.Title != nil || patch.URL != nil || patch.Public != nil {
+		t.Errorf("expected missing fields to be nil, got %+v", patch)
+	}
+	if patch.Excerpt == nil || *patch.Excerpt != "" || patch.Tags == nil || len(*patch.Tags) != 0 {
+		t.Errorf("expected null fields to be empty, got %+v", patch)
+	}
+}
+
+func TestUpdateBookmarksProgress(t *testing.T) {
+	clearTestData()
+	defer clearTestData()
+
+	indices := []string{}
+	for _, url := range []string{"http://127.0.0.1:1/first", "http://127.0.0.1:1/second"} {
+		book, err := addBookmark(DB, model.Bookmark{URL: url, Title: "Title"}, true)
+		if err != nil {
+			t.Fatalf("failed to create testing bookmark: %v", err)
+		}
+		indices = append(indices, fmt.Sprintf("%d", book.ID))
+	}
+
+	// Progress is reported before fetching and after each bookmark is fetched
+	reported := []string{}
+	progress := func(fetched, total int) {
+		reported = append(reported, fmt.Sprintf("%d/%d", fetched, total))
+	}
+
+	if _, err := updateBookmarks(DB, indices, model.BookmarkPatch{}, nil, false, false, progress); err != nil {
+		t.Fatalf("failed to update bookmarks: %v", err)
+	}
+	if got := strings.Join(reported, ","); got != "0/2,1/2,2/2" {
+		t.Errorf("expected progress 0/2,1/2,2/2, got %s", got)
+	}
+
+	// Nothing is fetched while offline
+	reported = nil
+	if _, err := updateBookmarks(DB, indices, model.BookmarkPatch{}, nil, true, false, progress); err != nil {
+		t.Fatalf("failed to update bookmarks: %v", err)
+	}
+	if len(reported) != 0 {
+		t.Errorf("expected no progress while offline, got %v", reported)
 	}
 }
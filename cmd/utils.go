@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/fatih/color"
+	"github.com/s-frostick/shiori/database"
+	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -15,6 +18,7 @@ var (
 	cURL      = color.New(color.FgHiYellow)
 	cError    = color.New(color.FgHiRed)
 	cExcerpt  = color.New(color.FgHiWhite)
+	cMatch    = color.New(color.FgHiYellow).Add(color.Underline)
 	cTag      = color.New(color.FgHiBlue)
 )
 
@@ -23,8 +27,26 @@ func getTerminalWidth() int {
 	return width
 }
 
-func checkError(err error) {
-	if err != nil {
-		panic(err)
+// pageFromFlags reads --limit and --page flags of the command.
+func pageFromFlags(cmd *cobra.Command) (database.Page, error) {
+	limit, _ := cmd.Flags().GetInt("limit")
+	number, _ := cmd.Flags().GetInt("page")
+	return database.NewPage(limit, number)
+}
+
+// setFlagsFromEnv sets the flags that aren't specified in command line
+// from their environment variable, if it's set.
+func setFlagsFromEnv(cmd *cobra.Command, flagEnvs map[string]string) error {
+	for name, env := range flagEnvs {
+		value, found := os.LookupEnv(env)
+		if !found || value == "" || cmd.Flags().Changed(name) {
+			continue
+		}
+
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("%s is not valid: %v", env, err)
+		}
 	}
+
+	return nil
 }
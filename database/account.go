@@ -0,0 +1,50 @@
+package database
+
+import "strings"
+
+// Role decides what an account is allowed to do. Each role is allowed
+// to do everything the roles below it can do.
+type Role string
+
+// Roles of account, from the most powerful one.
+const (
+	RoleAdmin  Role = "admin"  // manages accounts
+	RoleEditor Role = "editor" // manages bookmarks and tags
+	RoleViewer Role = "viewer" // only reads bookmarks and tags
+)
+
+// roleLevels ranks the roles, so a role includes every role with lower level.
+var roleLevels = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// ParseRole converts the name of role into Role.
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := roleLevels[role]; !ok {
+		return "", NewError(ErrValidation, "Role must be one of admin, editor or viewer")
+	}
+
+	return role, nil
+}
+
+// Includes reports whether the role is allowed to do everything the other role can do.
+// Unknown role includes nothing.
+func (r Role) Includes(other Role) bool {
+	level, ok := roleLevels[r]
+	return ok && level >= roleLevels[other]
+}
+
+// accountCondition returns condition that limits the column to the rows owned by the account,
+// e.g. " AND account_id = ?", or empty string when accountID is zero which means the
+// database isn't limited to any account. The argument is appended to args.
+func accountCondition(column string, accountID int64, args *[]interface{}, placeholder func(n int) string) string {
+	if accountID == 0 {
+		return ""
+	}
+
+	*args = append(*args, accountID)
+	return " AND " + column + " = " + placeholder(len(*args))
+}
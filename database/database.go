@@ -1,46 +1,143 @@
 package database
 
 import (
-	"database/sql"
+	"time"
 
 	"github.com/s-frostick/shiori/model"
 )
 
 // Database is interface for manipulating data in database.
+// Failures that caused by the submitted data are returned as one of
+// the error kinds in errors.go, so caller can tell them apart from
+// the database failures.
+//
+// Bookmarks and tags are owned by accounts. The database returned by ForAccount
+// only sees and changes the ones owned by that account, and creates new ones for it.
 type Database interface {
+	// ForAccount returns the database limited to bookmarks and tags of the account.
+	// Zero ID returns the database that can access bookmarks and tags of every account.
+	ForAccount(accountID int64) Database
+
+	// Migrations returns every schema migration known by the database.
+	Migrations() []Migration
+
+	// SchemaVersion returns the version of the latest migration applied to the database.
+	SchemaVersion() (int, error)
+
+	// Migrate applies all pending migrations and returns the applied ones.
+	Migrate() ([]Migration, error)
+
 	// SaveBookmark saves new bookmark to database.
 	CreateBookmark(bookmark model.Bookmark) (int64, error)
 
 	//CreateVideo save new video to database
 	CreateVideo(bookmarkID int64, video model.Video) (int64, error)
 
-	// GetBookmarks fetch list of bookmarks based on submitted indices.
-	GetBookmarks(withContent bool, indices ...string) ([]model.Bookmark, error)
+	// GetBookmarks fetch list of bookmarks based on submitted indices, limited to the specified page.
+	GetBookmarks(withContent bool, page Page, indices ...string) ([]model.Bookmark, error)
 
-	//GetTags fetch list of tags and their frequency
+	// GetTags fetch list of tags and their frequency, including the unused tags.
 	GetTags() ([]model.Tag, error)
 
-	// DeleteBookmarks removes all record with matching indices from database.
+	// RenameTag changes the name of tag with the specified ID.
+	RenameTag(id int64, name string) (model.Tag, error)
+
+	// MergeTags moves the bookmarks of source tags into the target tag, then removes the source tags.
+	MergeTags(targetID int64, sourceIDs ...int64) error
+
+	// DeleteTags removes tags with the specified IDs, detaching them from their bookmarks.
+	DeleteTags(ids ...int64) error
+
+	// PruneTags removes tags that are not used by any bookmark. Returns the count of removed tags.
+	PruneTags() (int, error)
+
+	// DeleteBookmarks moves all bookmarks with matching indices to trash.
 	DeleteBookmarks(indices ...string) error
 
-	// SearchBookmarks search bookmarks by the keyword or tags.
-	SearchBookmarks(orderLatest bool, keyword string, tags ...string) ([]model.Bookmark, error)
+	// GetDeletedBookmarks fetch list of bookmarks in trash, limited to the specified page.
+	// Returns the bookmarks in the page and the count of all bookmarks in trash.
+	GetDeletedBookmarks(page Page) ([]model.Bookmark, int, error)
+
+	// RestoreBookmarks moves bookmarks with matching indices out of trash.
+	RestoreBookmarks(indices ...string) (int, error)
+
+	// SetBookmarksPublic shares or stops sharing the bookmarks with matching indices, which decides
+	// whether they can be read without login. Returns the count of matching bookmarks.
+	SetBookmarksPublic(public bool, indices ...string) (int, error)
+
+	// GetVideoBookmarks returns IDs of the bookmarks that own the video file. The file is
+	// shared by every bookmark of the same video, which may belong to different accounts.
+	GetVideoBookmarks(filename string) ([]int64, error)
+
+	// PurgeBookmarks permanently removes bookmarks in trash with matching
+	// indices that were deleted before the specified time.
+	PurgeBookmarks(deletedBefore time.Time, indices ...string) (int, error)
+
+	// DeleteUnusedVideos removes the videos that aren't used by any bookmark anymore.
+	// Returns the filenames that no video uses anymore, so the files can be removed.
+	DeleteUnusedVideos() ([]string, error)
+
+	// SearchBookmarks search bookmarks that match the query, sorted by the specified order.
+	// Returns the bookmarks in the specified page and the count of all matching bookmarks.
+	SearchBookmarks(order SortOrder, page Page, query Query) ([]model.Bookmark, int, error)
 
 	// UpdateBookmarks updates the saved bookmark in database.
 	UpdateBookmarks(bookmarks []model.Bookmark) ([]model.Bookmark, error)
 
-	// CreateAccount creates new account in database
-	CreateAccount(username, password string) error
+	// CreateAccount creates new account with the specified role in database.
+	// The first account takes the bookmarks and tags that were saved without owner.
+	CreateAccount(username, password string, role Role) error
+
+	// GetAccount fetch the account with the specified ID
+	GetAccount(id int64) (model.Account, error)
 
 	// GetAccounts fetch list of accounts in database
 	GetAccounts(keyword string, exact bool) ([]model.Account, error)
 
-	// DeleteAccounts removes all record with matching usernames
+	// DeleteAccounts removes all record with matching usernames, along with their tags, sessions and API tokens.
+	// Accounts that still own bookmarks can't be removed.
 	DeleteAccounts(usernames ...string) error
-}
 
-func checkError(err error) {
-	if err != nil && err != sql.ErrNoRows {
-		panic(err)
-	}
+	// SetAccountRole changes the role of account with matching username.
+	SetAccountRole(username string, role Role) error
+
+	// SetAccountPassword changes the password of account with matching username.
+	SetAccountPassword(username, password string) error
+
+	// CreateSession records new login session, and removes the expired ones.
+	CreateSession(session model.Session) error
+
+	// GetSession fetch the session with the specified ID, if it hasn't expired.
+	GetSession(id string) (model.Session, error)
+
+	// GetSessions fetch the sessions of account that haven't expired, the newest first.
+	// Zero accountID fetch the sessions of every account.
+	GetSessions(accountID int64) ([]model.Session, error)
+
+	// DeleteSessions revokes the sessions of account with matching IDs. If no ID is submitted,
+	// every session of the account is revoked. Zero accountID matches every account.
+	// Returns the number of revoked sessions.
+	DeleteSessions(accountID int64, ids ...string) (int, error)
+
+	// CreateAPIToken saves new API token. Returns the token with its new ID.
+	CreateAPIToken(token model.APIToken) (model.APIToken, error)
+
+	// UseAPIToken fetch the API token with matching hash, and records that it's used now.
+	UseAPIToken(hash string) (model.APIToken, error)
+
+	// GetAPITokens fetch the API tokens of account, ordered by name.
+	// Zero accountID fetch the API tokens of every account.
+	GetAPITokens(accountID int64) ([]model.APIToken, error)
+
+	// DeleteAPITokens revokes the API tokens of account with matching IDs. If no ID is submitted,
+	// every API token of the account is revoked. Zero accountID matches every account.
+	// Returns the number of revoked tokens.
+	DeleteAPITokens(accountID int64, ids ...int64) (int, error)
+
+	// CreateAuthEvent saves new event into audit log of logins.
+	CreateAuthEvent(event model.AuthEvent) error
+
+	// GetAuthEvents fetch the events in audit log of logins, the newest first.
+	// Empty username fetch the events of every username.
+	GetAuthEvents(username string, page Page) ([]model.AuthEvent, error)
 }
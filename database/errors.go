@@ -0,0 +1,39 @@
+package database
+
+import "errors"
+
+// Kinds of error returned by Database. Use errors.Is to check
+// which kind an error belongs to, e.g. errors.Is(err, ErrNotFound).
+var (
+	// ErrNotFound is returned when the requested record doesn't exist.
+	ErrNotFound = errors.New("Record not found")
+
+	// ErrConflict is returned when the record clashes with an existing one, e.g. duplicate URL.
+	ErrConflict = errors.New("Record already exists")
+
+	// ErrInvalidIndex is returned when the submitted indices are not valid.
+	ErrInvalidIndex = errors.New("Index is not valid")
+
+	// ErrValidation is returned when the submitted data is not valid.
+	ErrValidation = errors.New("Data is not valid")
+)
+
+// Error is an error with a descriptive message that belongs to one of the kinds above.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+// NewError creates a new error with the specified kind and message.
+func NewError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the kind of the error.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// indexRange is a range of bookmark IDs, which includes both ends.
+type indexRange struct {
+	min, max int64
+}
+
+// parseIndices converts the submitted indices into list of ID ranges.
+// Each index can be a single ID (e.g. 5) or hyphenated range (e.g. 100-200).
+// The ranges are kept as they are, so huge range doesn't need huge memory.
+func parseIndices(indices []string) ([]indexRange, error) {
+	ranges := []indexRange{}
+
+	for _, strIndex := range indices {
+		strIndex = strings.TrimSpace(strIndex)
+		errInvalid := NewError(ErrInvalidIndex, fmt.Sprintf("Index is not valid: %q", strIndex))
+
+		parts := strings.Split(strIndex, "-")
+		if len(parts) > 2 {
+			return nil, errInvalid
+		}
+
+		minIndex, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || minIndex < 1 {
+			return nil, errInvalid
+		}
+
+		maxIndex := minIndex
+		if len(parts) == 2 {
+			maxIndex, err = strconv.ParseInt(parts[1], 10, 64)
+			if err != nil || minIndex > maxIndex {
+				return nil, errInvalid
+			}
+		}
+
+		ranges = append(ranges, indexRange{minIndex, maxIndex})
+	}
+
+	return ranges, nil
+}
+
+// indexCondition converts the ranges into SQL condition for the column, e.g.
+// "(id IN (?,?) OR id BETWEEN ? AND ?)". The arguments are appended to args,
+// while placeholder creates the placeholder for n-th argument.
+func indexCondition(column string, ranges []indexRange, args *[]interface{}, placeholder func(n int) string) string {
+	bind := func(arg interface{}) string {
+		*args = append(*args, arg)
+		return placeholder(len(*args))
+	}
+
+	// Bind the arguments in the same order as their placeholders
+	// appear in the condition, since "?" is positional.
+	singles := []int64{}
+	conditions := []string{}
+	for _, r := range ranges {
+		if r.min == r.max {
+			singles = append(singles, r.min)
+			continue
+		}
+
+		conditions = append(conditions, fmt.Sprintf("%s BETWEEN %s AND %s", column, bind(r.min), bind(r.max)))
+	}
+
+	if len(singles) > 0 {
+		placeholders := []string{}
+		for _, index := range singles {
+			placeholders = append(placeholders, bind(index))
+		}
+		conditions = append(conditions, column+" IN ("+strings.Join(placeholders, ",")+")")
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// questionPlaceholder is placeholder of every query, rebound to the one used by DBMS.
+func questionPlaceholder(int) string {
+	return "?"
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseIndices(t *testing.T) {
+	tests := []struct {
+		indices []string
+		want    []indexRange
+		wantErr bool
+	}{
+		{[]string{}, []indexRange{}, false},
+		{[]string{"5"}, []indexRange{{5, 5}}, false},
+		{[]string{"1-3", " 7 ", "9"}, []indexRange{{1, 3}, {7, 7}, {9, 9}}, false},
+		{[]string{"1-100000000"}, []indexRange{{1, 100000000}}, false},
+		{[]string{"4-4"}, []indexRange{{4, 4}}, false},
+		{[]string{"0"}, nil, true},
+		{[]string{"-1"}, nil, true},
+		{[]string{"3-1"}, nil, true},
+		{[]string{"1-2-3"}, nil, true},
+		{[]string{"1-"}, nil, true},
+		{[]string{"a"}, nil, true},
+		{[]string{"1", "b-2"}, nil, true},
+		{[]string{"99999999999999999999"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		ranges, err := parseIndices(tt.indices)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidIndex) {
+				t.Errorf("%q: expected invalid index error, got %v", tt.indices, err)
+			}
+			continue
+		}
+
+		if err != nil || fmt.Sprint(ranges) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: expected %v, got %v (%v)", tt.indices, tt.want, ranges, err)
+		}
+	}
+}
+
+func TestIndexCondition(t *testing.T) {
+	tests := []struct {
+		ranges      []indexRange
+		placeholder func(int) string
+		want        string
+		wantArgs    []interface{}
+	}{
+		{
+			[]indexRange{{5, 5}},
+			questionPlaceholder,
+			"(id IN (?))",
+			[]interface{}{int64(5)},
+		},
+		{
+			[]indexRange{{7, 7}, {1, 100000}, {9, 9}},
+			questionPlaceholder,
+			"(id BETWEEN ? AND ? OR id IN (?,?))",
+			[]interface{}{int64(1), int64(100000), int64(7), int64(9)},
+		},
+	}
+
+	for _, tt := range tests {
+		args := []interface{}{}
+		got := indexCondition("id", tt.ranges, &args, tt.placeholder)
+		if got != tt.want || fmt.Sprint(args) != fmt.Sprint(tt.wantArgs) {
+			t.Errorf("%v: expected %s %v, got %s %v", tt.ranges, tt.want, tt.wantArgs, got, args)
+		}
+	}
+}
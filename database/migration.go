@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration is a single versioned change of the database schema.
+type Migration struct {
+	Version     int
+	Description string
+	statements  []string
+
+	// guards skip the statements that have been applied before, keyed by the index
+	// of statement. The guard is a query that counts what the statement creates, e.g.
+	// the column it adds. It's needed by MySQL, which commits DDL statements implicitly,
+	// so a failed migration may be applied partially and must be able to run again.
+	guards map[int]string
+}
+
+// legacyVersionFunc detects the schema version of a database
+// that was created before the schema_version table existed.
+type legacyVersionFunc func(db *sqlx.DB) (int, error)
+
+// schemaVersion returns the version of the latest migration applied to the database.
+// If nothing has been recorded yet, it falls back to legacyVersion (if any).
+func schemaVersion(db *sqlx.DB, legacyVersion legacyVersionFunc) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version(
+		version INTEGER NOT NULL,
+		description VARCHAR(250) NOT NULL,
+		applied VARCHAR(20) NOT NULL,
+		CONSTRAINT schema_version_PK PRIMARY KEY(version))`)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := recordedVersion(db)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 && legacyVersion != nil {
+		return legacyVersion(db)
+	}
+
+	return version, nil
+}
+
+// migrate applies all migrations newer than the current schema version. Each
+// migration runs in its own transaction together with its schema_version record,
+// so a failed migration leaves the database in the previous version.
+// Returns the list of applied migrations.
+func migrate(db *sqlx.DB, migrations []Migration, legacyVersion legacyVersionFunc) ([]Migration, error) {
+	currentVersion, err := schemaVersion(db, legacyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	stmtInsertVersion := db.Rebind(`INSERT INTO schema_version
+		(version, description, applied) VALUES (?, ?, ?)`)
+
+	// If the database was created before schema_version existed,
+	// record the migrations that it already has.
+	lastRecorded, err := recordedVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	for _, m := range migrations {
+		if m.Version <= lastRecorded || m.Version > currentVersion {
+			continue
+		}
+
+		_, err = db.Exec(stmtInsertVersion, m.Version, m.Description, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply the pending migrations
+	applied := []Migration{}
+	for _, m := range migrations {
+		if m.Version <= currentVersion {
+			continue
+		}
+
+		err = applyMigration(db, m, stmtInsertVersion)
+		if err != nil {
+			return applied, fmt.Errorf("Migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// recordedVersion returns the latest version saved in schema_version table.
+func recordedVersion(db *sqlx.DB) (int, error) {
+	version := 0
+	err := db.Get(&version, `SELECT version FROM schema_version ORDER BY version DESC LIMIT 1`)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func applyMigration(db *sqlx.DB, m Migration, stmtInsertVersion string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for i, statement := range m.statements {
+		if guard, ok := m.guards[i]; ok {
+			nApplied := 0
+			if err = tx.Get(&nApplied, guard); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if nApplied > 0 {
+				continue
+			}
+		}
+
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	if _, err = tx.Exec(stmtInsertVersion, m.Version, m.Description, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"os"
+	fp "path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/s-frostick/shiori/model"
+)
+
+// openTestSQLite creates a new SQLite database in a temporary directory,
+// optionally filled with the SQL fixtures from testdata.
+func openTestSQLite(t *testing.T, fixtures ...string) *SQLiteDatabase {
+	db, err := OpenSQLiteDatabase(fp.Join(t.TempDir(), "shiori.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, fixture := range fixtures {
+		if strings.HasSuffix(fixture, ".sql") {
+			content, err := os.ReadFile(fp.Join("testdata", fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+			fixture = string(content)
+		}
+
+		if _, err = db.Exec(fixture); err != nil {
+			t.Fatalf("failed to load fixture: %v", err)
+		}
+	}
+
+	return db
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	latest := sqliteMigrations[len(sqliteMigrations)-1].Version
+
+	tests := []struct {
+		name          string
+		fixtures      []string
+		legacyVersion int
+		nBookmarks    int
+	}{
+		{
+			name: "new database",
+		},
+		{
+			name:          "database without video support",
+			fixtures:      []string{"sqlite_v1.sql"},
+			legacyVersion: 1,
+			nBookmarks:    2,
+		},
+		{
+			name: "database with video support",
+			fixtures: []string{"sqlite_v1.sql",
+				`ALTER TABLE bookmark ADD COLUMN isvideo INTEGER NOT NULL DEFAULT 0;
+				CREATE TABLE video(id INTEGER NOT NULL PRIMARY KEY, downloaded INTEGER NOT NULL, filename TEXT NOT NULL);
+				CREATE TABLE bookmark_video(bookmark_id INTEGER NOT NULL, video_id INTEGER NOT NULL);`},
+			legacyVersion: 2,
+			nBookmarks:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		db := openTestSQLite(t, tt.fixtures...)
+
+		version, err := db.SchemaVersion()
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %v", tt.name, err)
+			continue
+		}
+		if version != tt.legacyVersion {
+			t.Errorf("%s: expected version %d before migrate, got %d", tt.name, tt.legacyVersion, version)
+		}
+
+		applied, err := db.Migrate()
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(applied) != latest-tt.legacyVersion {
+			t.Errorf("%s: expected %d applied migrations, got %d", tt.name, latest-tt.legacyVersion, len(applied))
+		}
+
+		version, err = db.SchemaVersion()
+		if err != nil || version != latest {
+			t.Errorf("%s: expected version %d after migrate, got %d (%v)", tt.name, latest, version, err)
+		}
+
+		// Old data must survive and the new columns must work
+		bookmarks, err := db.GetBookmarks(true, Page{})
+		if err != nil {
+			t.Errorf("%s: failed to read bookmarks: %v", tt.name, err)
+			continue
+		}
+		if len(bookmarks) != tt.nBookmarks {
+			t.Errorf("%s: expected %d bookmarks, got %d", tt.name, tt.nBookmarks, len(bookmarks))
+		}
+
+		id, err := db.CreateBookmark(model.Bookmark{
+			URL:     "https://www.youtube.com/watch?v=rFejpH_tAHM",
+			Title:   "dotGo 2015",
+			IsVideo: true,
+		})
+		if err != nil {
+			t.Errorf("%s: failed to save bookmark: %v", tt.name, err)
+			continue
+		}
+		if _, err = db.CreateVideo(id, model.Video{Filename: "dotgo.mp4", Downloaded: true}); err != nil {
+			t.Errorf("%s: failed to save video: %v", tt.name, err)
+		}
+
+		// Running it again must be a no-op
+		applied, err = db.Migrate()
+		if err != nil || len(applied) != 0 {
+			t.Errorf("%s: expected no migrations on second run, got %d (%v)", tt.name, len(applied), err)
+		}
+	}
+}
+
+func TestSQLiteMigrateKeepsData(t *testing.T) {
+	db := openTestSQLite(t, "sqlite_v1.sql")
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	bookmarks, err := db.GetBookmarks(true, Page{}, "1")
+	if err != nil || len(bookmarks) != 1 {
+		t.Fatalf("expected 1 bookmark, got %d (%v)", len(bookmarks), err)
+	}
+
+	book := bookmarks[0]
+	if book.Title != "Shiori" || book.Excerpt != "Simple bookmark manager" || book.IsVideo {
+		t.Errorf("bookmark changed after migration: %+v", book)
+	}
+	if len(book.Tags) != 2 {
+		t.Errorf("expected 2 tags, got %d", len(book.Tags))
+	}
+	if book.Content == "" {
+		t.Error("expected bookmark content, got empty string")
+	}
+
+	query, _ := ParseQuery("programming")
+	results, _, err := db.SearchBookmarks(SortRelevance, Page{}, query)
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected 1 search result, got %d (%v)", len(results), err)
+	}
+
+	accounts, err := db.GetAccounts("shiori", true)
+	if err != nil || len(accounts) != 1 {
+		t.Errorf("expected 1 account, got %d (%v)", len(accounts), err)
+	} else if accounts[0].Role != string(RoleAdmin) {
+		t.Errorf("expected existing account to become admin, got %q", accounts[0].Role)
+	}
+}
+
+func TestMigrateSkipsGuardedStatements(t *testing.T) {
+	db := openTestSQLite(t)
+
+	// The first statement has been applied by a migration that failed half-way
+	_, err := db.Exec(`CREATE TABLE item(id INTEGER NOT NULL, name TEXT NOT NULL)`)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	migrations := []Migration{{
+		Version:     1,
+		Description: "Add note and flag of item",
+		statements: []string{
+			`ALTER TABLE item ADD COLUMN note TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE item ADD COLUMN flag INTEGER NOT NULL DEFAULT 0`,
+		},
+		guards: map[int]string{
+			0: `SELECT COUNT(*) FROM pragma_table_info('item') WHERE name = 'note'`,
+			1: `SELECT COUNT(*) FROM pragma_table_info('item') WHERE name = 'flag'`,
+		},
+	}}
+
+	_, err = db.Exec(migrations[0].statements[0])
+	if err != nil {
+		t.Fatalf("failed to apply first statement: %v", err)
+	}
+
+	applied, err := migrate(&db.DB, migrations, nil)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("expected 1 applied migration, got %d (%v)", len(applied), err)
+	}
+
+	nColumns := 0
+	err = db.Get(&nColumns, `SELECT COUNT(*) FROM pragma_table_info('item') WHERE name IN ('note', 'flag')`)
+	if err != nil || nColumns != 2 {
+		t.Errorf("expected both columns, got %d (%v)", nColumns, err)
+	}
+}
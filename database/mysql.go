@@ -0,0 +1,76 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// MySQLDatabase is implementation of Database interface for connecting to MySQL or MariaDB database.
+type MySQLDatabase struct {
+	sqlDatabase
+}
+
+// OpenMySQLDatabase creates and open connection to new MySQL or MariaDB database.
+// The dsn is passed as it is to go-sql-driver, e.g. "user:password@tcp(localhost:3306)/shiori".
+// The schema is not touched here, call Migrate to create or upgrade the tables.
+func OpenMySQLDatabase(dsn string) (*MySQLDatabase, error) {
+	db, err := sqlx.Connect("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MySQLDatabase{sqlDatabase{DB: *db, dialect: &mysqlDialect}}, nil
+}
+
+// mysqlDialect keeps bookmark content in table with FULLTEXT index. The words and phrases
+// are matched in boolean mode, while the relevance score is given by natural language mode.
+// MySQL has no function to make snippet, so it's always empty.
+//
+// The first schema was created without recording its version, but the first migration
+// creates the same tables only if they don't exist, so it needs no legacy detection.
+var mysqlDialect = sqlDialect{
+	migrations: mysqlMigrations,
+
+	contentKey: "bookmark_id",
+	insertContent: `INSERT INTO bookmark_content
+		(bookmark_id, title, content, html) VALUES (:id, :title, :content, :html)`,
+	updateContent: `UPDATE bookmark_content SET
+		title = :title, content = :content, html = :html WHERE bookmark_id = :id`,
+
+	insertIgnore: func(query string) string {
+		return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	},
+	datetime: func(column string) string { return column },
+	like:     "LIKE",
+
+	ftsRank: func(keywords []queryTerm, args *[]interface{}) string {
+		values := []string{}
+		for _, term := range keywords {
+			values = append(values, term.value)
+		}
+
+		keyword := strings.Join(values, " ")
+		*args = append(*args, keyword, keyword)
+
+		return `SELECT bookmark_id, MATCH(title, content) AGAINST (? IN NATURAL LANGUAGE MODE) score,
+			'' snippet FROM bookmark_content
+			WHERE MATCH(title, content) AGAINST (? IN NATURAL LANGUAGE MODE)`
+	},
+	ftsMatch: func(placeholder string) string {
+		return `b.id IN (SELECT bookmark_id FROM bookmark_content
+			WHERE MATCH(title, content) AGAINST (` + placeholder + ` IN BOOLEAN MODE))`
+	},
+	ftsArg: func(term queryTerm) interface{} {
+		return `"` + strings.Replace(term.value, `"`, " ", -1) + `"`
+	},
+
+	uniqueViolation: mysqlUniqueViolation,
+}
+
+// mysqlUniqueViolation checks if err is caused by duplicate entry in UNIQUE key.
+func mysqlUniqueViolation(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
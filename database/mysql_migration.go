@@ -0,0 +1,192 @@
+package database
+
+// mysqlMigrations is the ordered list of schema changes for MySQL database.
+// Never edit a migration that has been released, add a new one instead.
+// Note that MySQL commits DDL statements implicitly, so unlike other databases
+// a failed migration may be applied partially. Tables are created only if they
+// don't exist, while each ALTER TABLE, which InnoDB applies as a whole, is guarded
+// by the column it adds, so applying the migration again skips what has been
+// applied. Keep the other statements idempotent.
+var mysqlMigrations = []Migration{{
+	Version:     1,
+	Description: "Create initial tables",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS account(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		username VARCHAR(250) NOT NULL,
+		password VARCHAR(250) NOT NULL,
+		CONSTRAINT account_PK PRIMARY KEY(id),
+		CONSTRAINT account_username_UNIQUE UNIQUE(username))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		image_url TEXT NOT NULL,
+		excerpt TEXT NOT NULL,
+		author TEXT NOT NULL,
+		min_read_time INT(11) NOT NULL DEFAULT 0,
+		max_read_time INT(11) NOT NULL DEFAULT 0,
+		modified DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		isvideo TINYINT(1) NOT NULL DEFAULT 0,
+		CONSTRAINT bookmark_PK PRIMARY KEY(id),
+		CONSTRAINT bookmark_url_UNIQUE UNIQUE(url(190)))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS tag(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		name VARCHAR(250) NOT NULL,
+		CONSTRAINT tag_PK PRIMARY KEY(id),
+		CONSTRAINT tag_name_UNIQUE UNIQUE(name))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_tag(
+		bookmark_id INT(11) NOT NULL,
+		tag_id INT(11) NOT NULL,
+		CONSTRAINT bookmark_tag_PK PRIMARY KEY(bookmark_id, tag_id),
+		CONSTRAINT bookmark_tag_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT bookmark_tag_tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS video(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		downloaded TINYINT(1) NOT NULL,
+		filename TEXT NOT NULL,
+		CONSTRAINT video_PK PRIMARY KEY(id))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_video(
+		bookmark_id INT(11) NOT NULL,
+		video_id INT(11) NOT NULL,
+		CONSTRAINT bookmark_video_PK PRIMARY KEY(bookmark_id, video_id),
+		CONSTRAINT bookmark_video_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT bookmark_video_video_id_FK FOREIGN KEY(video_id) REFERENCES video(id))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_content(
+		bookmark_id INT(11) NOT NULL,
+		title TEXT NOT NULL,
+		content MEDIUMTEXT NOT NULL,
+		html MEDIUMTEXT NOT NULL,
+		CONSTRAINT bookmark_content_PK PRIMARY KEY(bookmark_id),
+		FULLTEXT KEY bookmark_content_FT (title, content))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	},
+}, {
+	Version:     2,
+	Description: "Add trash for deleted bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN deleted DATETIME NULL DEFAULT NULL,
+		ADD INDEX bookmark_deleted_IDX (deleted)`,
+	},
+	guards: map[int]string{
+		0: mysqlColumnExists("bookmark", "deleted"),
+	},
+}, {
+	Version:     3,
+	Description: "Add parent of hierarchical tag",
+	statements: []string{
+		`ALTER TABLE tag ADD COLUMN parent_id INT(11) NULL DEFAULT NULL,
+		ADD CONSTRAINT tag_parent_id_FK FOREIGN KEY(parent_id) REFERENCES tag(id)`,
+	},
+	guards: map[int]string{
+		0: mysqlColumnExists("tag", "parent_id"),
+	},
+}, {
+	// URL and tag name become unique per account. Existing bookmarks
+	// and tags are given to the oldest account, if there's any.
+	Version:     4,
+	Description: "Add owner of bookmarks and tags",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN account_id INT(11) NOT NULL DEFAULT 0,
+		DROP INDEX bookmark_url_UNIQUE,
+		ADD CONSTRAINT bookmark_url_UNIQUE UNIQUE(account_id, url(190))`,
+
+		`ALTER TABLE tag ADD COLUMN account_id INT(11) NOT NULL DEFAULT 0,
+		DROP INDEX tag_name_UNIQUE,
+		ADD CONSTRAINT tag_name_UNIQUE UNIQUE(account_id, name)`,
+
+		`UPDATE bookmark SET account_id = COALESCE((SELECT MIN(id) FROM account), 0)`,
+
+		`UPDATE tag SET account_id = COALESCE((SELECT MIN(id) FROM account), 0)`,
+	},
+	guards: map[int]string{
+		0: mysqlColumnExists("bookmark", "account_id"),
+		1: mysqlColumnExists("tag", "account_id"),
+	},
+}, {
+	// Existing accounts keep managing everything as admin.
+	Version:     5,
+	Description: "Add role of accounts",
+	statements: []string{
+		`ALTER TABLE account ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'editor'`,
+		`UPDATE account SET role = 'admin'`,
+	},
+	guards: map[int]string{
+		0: mysqlColumnExists("account", "role"),
+	},
+}, {
+	Version:     6,
+	Description: "Add login sessions",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS session(
+		id VARCHAR(64) NOT NULL,
+		account_id INT(11) NOT NULL,
+		created DATETIME NOT NULL,
+		expires DATETIME NOT NULL,
+		CONSTRAINT session_PK PRIMARY KEY(id),
+		CONSTRAINT session_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	},
+}, {
+	// Only the hash of token is saved, the token itself is shown once when created.
+	Version:     7,
+	Description: "Add API tokens",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS api_token(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		account_id INT(11) NOT NULL,
+		name VARCHAR(250) NOT NULL,
+		hash VARCHAR(64) NOT NULL,
+		read_only TINYINT(1) NOT NULL DEFAULT 0,
+		created DATETIME NOT NULL,
+		last_used DATETIME NULL DEFAULT NULL,
+		CONSTRAINT api_token_PK PRIMARY KEY(id),
+		CONSTRAINT api_token_hash_UNIQUE UNIQUE(hash),
+		CONSTRAINT api_token_name_UNIQUE UNIQUE(account_id, name),
+		CONSTRAINT api_token_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	},
+}, {
+	// Events keep the submitted username, since it may not belong to any account.
+	Version:     8,
+	Description: "Add audit log of logins",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS auth_event(
+		id INT(11) NOT NULL AUTO_INCREMENT,
+		event VARCHAR(20) NOT NULL,
+		username VARCHAR(250) NOT NULL,
+		address VARCHAR(64) NOT NULL,
+		message TEXT NOT NULL,
+		created DATETIME NOT NULL,
+		CONSTRAINT auth_event_PK PRIMARY KEY(id),
+		INDEX auth_event_username_IDX (username))
+		ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	},
+}, {
+	Version:     9,
+	Description: "Add public flag of bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN public TINYINT(1) NOT NULL DEFAULT 0`,
+	},
+	guards: map[int]string{
+		0: mysqlColumnExists("bookmark", "public"),
+	},
+}}
+
+// mysqlColumnExists returns guard query that counts the column of table in current database.
+func mysqlColumnExists(table, column string) string {
+	return `SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '` + table + `' AND COLUMN_NAME = '` + column + `'`
+}
@@ -0,0 +1,161 @@
+package database
+
+// postgresMigrations is the ordered list of schema changes for PostgreSQL database.
+// Never edit a migration that has been released, add a new one instead.
+var postgresMigrations = []Migration{{
+	Version:     1,
+	Description: "Create initial tables",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS account(
+		id SERIAL,
+		username VARCHAR(250) NOT NULL,
+		password TEXT NOT NULL,
+		CONSTRAINT account_PK PRIMARY KEY(id),
+		CONSTRAINT account_username_UNIQUE UNIQUE(username))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark(
+		id SERIAL,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT '',
+		excerpt TEXT NOT NULL DEFAULT '',
+		author TEXT NOT NULL DEFAULT '',
+		min_read_time INTEGER NOT NULL DEFAULT 0,
+		max_read_time INTEGER NOT NULL DEFAULT 0,
+		modified TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		isvideo BOOLEAN NOT NULL DEFAULT FALSE,
+		CONSTRAINT bookmark_PK PRIMARY KEY(id),
+		CONSTRAINT bookmark_url_UNIQUE UNIQUE(url))`,
+
+		`CREATE TABLE IF NOT EXISTS tag(
+		id SERIAL,
+		name VARCHAR(250) NOT NULL,
+		CONSTRAINT tag_PK PRIMARY KEY(id),
+		CONSTRAINT tag_name_UNIQUE UNIQUE(name))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_tag(
+		bookmark_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		CONSTRAINT bookmark_tag_PK PRIMARY KEY(bookmark_id, tag_id),
+		CONSTRAINT bookmark_tag_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT bookmark_tag_tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id))`,
+
+		`CREATE TABLE IF NOT EXISTS video(
+		id SERIAL,
+		downloaded BOOLEAN NOT NULL,
+		filename TEXT NOT NULL,
+		CONSTRAINT video_PK PRIMARY KEY(id))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_video(
+		bookmark_id INTEGER NOT NULL,
+		video_id INTEGER NOT NULL,
+		CONSTRAINT bookmark_video_PK PRIMARY KEY(bookmark_id, video_id),
+		CONSTRAINT bookmark_video_bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT bookmark_video_video_id_FK FOREIGN KEY(video_id) REFERENCES video(id))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_content(
+		bookmark_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		html TEXT NOT NULL,
+		document TSVECTOR NOT NULL,
+		CONSTRAINT bookmark_content_PK PRIMARY KEY(bookmark_id))`,
+
+		`CREATE INDEX IF NOT EXISTS bookmark_content_document_IDX
+		ON bookmark_content USING GIN(document)`,
+	},
+}, {
+	Version:     2,
+	Description: "Add trash for deleted bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN IF NOT EXISTS deleted TIMESTAMP NULL DEFAULT NULL`,
+		`CREATE INDEX IF NOT EXISTS bookmark_deleted_IDX ON bookmark(deleted)`,
+	},
+}, {
+	Version:     3,
+	Description: "Add parent of hierarchical tag",
+	statements: []string{
+		`ALTER TABLE tag ADD COLUMN IF NOT EXISTS parent_id INTEGER NULL DEFAULT NULL
+		CONSTRAINT tag_parent_id_FK REFERENCES tag(id)`,
+		`CREATE INDEX IF NOT EXISTS tag_parent_id_IDX ON tag(parent_id)`,
+	},
+}, {
+	// URL and tag name become unique per account. Existing bookmarks
+	// and tags are given to the oldest account, if there's any.
+	Version:     4,
+	Description: "Add owner of bookmarks and tags",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN IF NOT EXISTS account_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE bookmark DROP CONSTRAINT IF EXISTS bookmark_url_UNIQUE`,
+		`ALTER TABLE bookmark ADD CONSTRAINT bookmark_url_UNIQUE UNIQUE(account_id, url)`,
+
+		`ALTER TABLE tag ADD COLUMN IF NOT EXISTS account_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE tag DROP CONSTRAINT IF EXISTS tag_name_UNIQUE`,
+		`ALTER TABLE tag ADD CONSTRAINT tag_name_UNIQUE UNIQUE(account_id, name)`,
+
+		`UPDATE bookmark SET account_id = COALESCE((SELECT MIN(id) FROM account), 0)`,
+		`UPDATE tag SET account_id = COALESCE((SELECT MIN(id) FROM account), 0)`,
+	},
+}, {
+	// Existing accounts keep managing everything as admin.
+	Version:     5,
+	Description: "Add role of accounts",
+	statements: []string{
+		`ALTER TABLE account ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'editor'`,
+		`UPDATE account SET role = 'admin'`,
+	},
+}, {
+	Version:     6,
+	Description: "Add login sessions",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS session(
+		id VARCHAR(64) NOT NULL,
+		account_id INTEGER NOT NULL,
+		created TIMESTAMP NOT NULL,
+		expires TIMESTAMP NOT NULL,
+		CONSTRAINT session_PK PRIMARY KEY(id),
+		CONSTRAINT session_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))`,
+
+		`CREATE INDEX IF NOT EXISTS session_account_id_IDX ON session(account_id)`,
+	},
+}, {
+	// Only the hash of token is saved, the token itself is shown once when created.
+	Version:     7,
+	Description: "Add API tokens",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS api_token(
+		id SERIAL,
+		account_id INTEGER NOT NULL,
+		name VARCHAR(250) NOT NULL,
+		hash VARCHAR(64) NOT NULL,
+		read_only BOOLEAN NOT NULL DEFAULT FALSE,
+		created TIMESTAMP NOT NULL,
+		last_used TIMESTAMP NULL DEFAULT NULL,
+		CONSTRAINT api_token_PK PRIMARY KEY(id),
+		CONSTRAINT api_token_hash_UNIQUE UNIQUE(hash),
+		CONSTRAINT api_token_name_UNIQUE UNIQUE(account_id, name),
+		CONSTRAINT api_token_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))`,
+	},
+}, {
+	// Events keep the submitted username, since it may not belong to any account.
+	Version:     8,
+	Description: "Add audit log of logins",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS auth_event(
+		id SERIAL,
+		event VARCHAR(20) NOT NULL,
+		username VARCHAR(250) NOT NULL,
+		address VARCHAR(64) NOT NULL,
+		message TEXT NOT NULL,
+		created TIMESTAMP NOT NULL,
+		CONSTRAINT auth_event_PK PRIMARY KEY(id))`,
+
+		`CREATE INDEX IF NOT EXISTS auth_event_username_IDX ON auth_event(username)`,
+	},
+}, {
+	Version:     9,
+	Description: "Add public flag of bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN IF NOT EXISTS public BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+}}
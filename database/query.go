@@ -0,0 +1,473 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed search query, for example :
+//
+//	tag:go -tag:old site:github.com after:2024-01-01 is:video "exact phrase"
+//
+// Words and phrases are searched in bookmark's URL, title and content. Terms are
+// combined with AND by default, and can be combined with OR, negated with NOT or "-",
+// and grouped with parentheses. Supported filters are tag:name (or #name), site:domain,
+// after:date, before:date (both in YYYY-MM-DD format) and is:video. Tag filter also
+// matches the descendants of hierarchical tag, so tag:dev matches tag dev/go.
+// Zero Query matches every bookmark.
+type Query struct {
+	expr queryExpr
+}
+
+type queryExpr interface{}
+
+type queryAnd struct {
+	left, right queryExpr
+}
+
+type queryOr struct {
+	left, right queryExpr
+}
+
+type queryNot struct {
+	expr queryExpr
+}
+
+// queryTerm is a single word, phrase or filter. Field is empty for word and phrase.
+type queryTerm struct {
+	field  string
+	value  string
+	phrase bool
+}
+
+// ParseQuery parses the search query. Empty query matches every bookmark.
+func ParseQuery(query string) (Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return Query{}, err
+	}
+
+	if len(tokens) == 0 {
+		return Query{}, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEnd {
+		return Query{}, queryError(tok.pos, "unexpected %q", tok.text)
+	}
+
+	return Query{expr: expr}, nil
+}
+
+// WithTags returns a copy of the query which also requires bookmarks to have all the tags.
+func (q Query) WithTags(tags ...string) Query {
+	for _, tag := range tags {
+		tag = NormalizeTagName(tag)
+		if tag == "" {
+			continue
+		}
+
+		term := queryTerm{field: "tag", value: tag}
+		if q.expr == nil {
+			q.expr = term
+		} else {
+			q.expr = queryAnd{q.expr, term}
+		}
+	}
+
+	return q
+}
+
+// HasKeyword checks if the query searches for any word or phrase,
+// which means its results can be sorted by relevance.
+func (q Query) HasKeyword() bool {
+	return len(q.keywords()) > 0
+}
+
+// keywords returns the words and phrases that are not negated,
+// which are used to rank the results and create the snippet.
+func (q Query) keywords() []queryTerm {
+	terms := []queryTerm{}
+
+	var walk func(expr queryExpr)
+	walk = func(expr queryExpr) {
+		switch e := expr.(type) {
+		case queryAnd:
+			walk(e.left)
+			walk(e.right)
+		case queryOr:
+			walk(e.left)
+			walk(e.right)
+		case queryTerm:
+			if e.field == "" {
+				terms = append(terms, e)
+			}
+		}
+	}
+
+	walk(q.expr)
+	return terms
+}
+
+func queryError(pos int, format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+	return NewError(ErrValidation, fmt.Sprintf("Query is not valid at position %d: %s", pos, message))
+}
+
+const (
+	tokenEnd = iota
+	tokenTerm
+	tokenOr
+	tokenAnd
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind int
+	term queryTerm
+	text string
+	pos  int
+}
+
+// tokenizeQuery splits the query into tokens. Position in token
+// and error starts from 1, so it's easier to read by user.
+func tokenizeQuery(query string) ([]queryToken, error) {
+	runes := []rune(query)
+	tokens := []queryToken{}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "(", pos: pos})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")", pos: pos})
+			i++
+			continue
+		case r == '-':
+			if i+1 >= len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == ')' {
+				return nil, queryError(pos, "nothing to exclude after \"-\"")
+			}
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-", pos: pos})
+			i++
+			continue
+		}
+
+		// Read the term, which may contain quoted part
+		start := i
+		field := ""
+		value := ""
+		phrase := false
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+			if runes[i] == '"' {
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+				if end >= len(runes) {
+					return nil, queryError(i+1, "missing closing quote")
+				}
+
+				value += string(runes[i+1 : end])
+				phrase = true
+				i = end + 1
+				continue
+			}
+
+			if runes[i] == ':' && field == "" && !phrase && isQueryField(value, runes[i+1:]) {
+				field = strings.ToLower(value)
+				value = ""
+				i++
+				continue
+			}
+
+			value += string(runes[i])
+			i++
+		}
+
+		text := string(runes[start:i])
+		switch {
+		case text == "OR":
+			tokens = append(tokens, queryToken{kind: tokenOr, text: text, pos: pos})
+		case text == "AND":
+			tokens = append(tokens, queryToken{kind: tokenAnd, text: text, pos: pos})
+		case text == "NOT":
+			tokens = append(tokens, queryToken{kind: tokenNot, text: text, pos: pos})
+		default:
+			if field == "" && !phrase && strings.HasPrefix(value, "#") && len(value) > 1 {
+				field = "tag"
+				value = value[1:]
+			}
+
+			term, err := newQueryTerm(field, value, phrase)
+			if err != nil {
+				return nil, queryError(pos, "%v", err)
+			}
+
+			tokens = append(tokens, queryToken{kind: tokenTerm, term: term, text: text, pos: pos})
+		}
+	}
+
+	return tokens, nil
+}
+
+// isQueryField checks if the text before colon is the name of a filter. Unknown name
+// made of letters is treated as typo, except when it looks like URL scheme (e.g. https://).
+func isQueryField(name string, rest []rune) bool {
+	if name == "" || strings.HasPrefix(string(rest), "//") {
+		return false
+	}
+
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newQueryTerm(field, value string, phrase bool) (queryTerm, error) {
+	term := queryTerm{field: field, value: value, phrase: phrase}
+	if field == "" {
+		if strings.TrimSpace(value) == "" {
+			return term, fmt.Errorf("empty phrase")
+		}
+		return term, nil
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return term, fmt.Errorf("%s: needs a value", field)
+	}
+
+	switch field {
+	case "tag":
+		value = NormalizeTagName(value)
+		if value == "" {
+			return term, fmt.Errorf("%s: needs a value", field)
+		}
+	case "site":
+	case "after", "before":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return term, fmt.Errorf("%s: needs date in YYYY-MM-DD format, got %q", field, value)
+		}
+	case "is":
+		if value != "video" {
+			return term, fmt.Errorf("is: only supports \"video\", got %q", value)
+		}
+	default:
+		return term, fmt.Errorf("unknown filter %q, expected tag, site, after, before or is", field+":")
+	}
+
+	term.value = value
+	return term, nil
+}
+
+// queryParser parses the tokens with following grammar :
+//
+//	or    = and { "OR" and }
+//	and   = unary { [ "AND" ] unary }
+//	unary = ( "NOT" | "-" ) unary | "(" or ")" | term
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos >= len(p.tokens) {
+		end := 1
+		if len(p.tokens) > 0 {
+			last := p.tokens[len(p.tokens)-1]
+			end = last.pos + len([]rune(last.text))
+		}
+		return queryToken{kind: tokenEnd, text: "end of query", pos: end}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = queryOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peek().kind {
+		case tokenEnd, tokenClose, tokenOr:
+			return left, nil
+		case tokenAnd:
+			p.next()
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = queryAnd{left, right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryExpr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNot:
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{expr}, nil
+	case tokenOpen:
+		if p.peek().kind == tokenClose {
+			return nil, queryError(tok.pos, "empty parentheses")
+		}
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.next(); closing.kind != tokenClose {
+			return nil, queryError(tok.pos, "missing closing parenthesis")
+		}
+		return expr, nil
+	case tokenTerm:
+		return tok.term, nil
+	case tokenEnd:
+		return nil, queryError(tok.pos, "missing term at the end of query")
+	default:
+		return nil, queryError(tok.pos, "expected term, got %q", tok.text)
+	}
+}
+
+// likeEscape is the escape character in LIKE pattern. It's not backslash, since
+// MySQL treats backslash in string literal as escape character as well.
+const likeEscape = "!"
+
+// escapeLike escapes the characters that have special meaning in LIKE pattern,
+// so the value is matched as it is.
+func escapeLike(value string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(value)
+}
+
+// queryBuilder converts Query into SQL condition for bookmark table aliased as b.
+// The terms are matched against the full text index using match function,
+// which differs between DBMS, while the rest are shared by all of them.
+type queryBuilder struct {
+	args        *[]interface{}
+	placeholder func(n int) string
+	like        string
+	match       func(placeholder string) string
+	matchArg    func(term queryTerm) interface{}
+}
+
+// bind appends arg to the query arguments and returns its placeholder.
+func (qb queryBuilder) bind(arg interface{}) string {
+	*qb.args = append(*qb.args, arg)
+	return qb.placeholder(len(*qb.args))
+}
+
+// where returns the condition of the query that can be appended
+// to WHERE clause, or empty string if query matches everything.
+func (qb queryBuilder) where(q Query) string {
+	if q.expr == nil {
+		return ""
+	}
+
+	return " AND " + qb.build(q.expr)
+}
+
+// likeCondition returns condition that column matches LIKE pattern, whose special
+// characters in the searched value must be escaped using escapeLike.
+func (qb queryBuilder) likeCondition(column, pattern string) string {
+	return column + " " + qb.like + " " + qb.bind(pattern) + " ESCAPE '" + likeEscape + "'"
+}
+
+func (qb queryBuilder) build(expr queryExpr) string {
+	switch e := expr.(type) {
+	case queryAnd:
+		return "(" + qb.build(e.left) + " AND " + qb.build(e.right) + ")"
+	case queryOr:
+		return "(" + qb.build(e.left) + " OR " + qb.build(e.right) + ")"
+	case queryNot:
+		return "NOT " + qb.build(e.expr)
+	case queryTerm:
+		return qb.term(e)
+	default:
+		panic(fmt.Sprintf("unknown query expression %T", expr))
+	}
+}
+
+func (qb queryBuilder) term(term queryTerm) string {
+	switch term.field {
+	case "tag":
+		// Match the tag and all of its descendants
+		prefix, prefixLength := descendantPrefix(term.value)
+		return `b.id IN (SELECT bt.bookmark_id FROM bookmark_tag bt
+			JOIN tag t ON t.id = bt.tag_id WHERE t.name = ` + qb.bind(term.value) +
+			` OR substr(t.name, 1, ` + qb.bind(prefixLength) + `) = ` + qb.bind(prefix) + `)`
+	case "site":
+		// Match the domain and its subdomains, with or without path
+		conditions := []string{}
+		domain := escapeLike(term.value)
+		for _, pattern := range []string{"%://", "%."} {
+			conditions = append(conditions,
+				qb.likeCondition("b.url", pattern+domain),
+				qb.likeCondition("b.url", pattern+domain+"/%"))
+		}
+		return "(" + strings.Join(conditions, " OR ") + ")"
+	case "after":
+		return "b.modified >= " + qb.bind(term.value)
+	case "before":
+		return "b.modified < " + qb.bind(term.value)
+	case "is":
+		return "b.isvideo = " + qb.bind(true)
+	default:
+		url := qb.likeCondition("b.url", "%"+escapeLike(term.value)+"%")
+		content := qb.match(qb.bind(qb.matchArg(term)))
+		return "(" + url + " OR " + content + ")"
+	}
+}
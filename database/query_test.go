@@ -0,0 +1,157 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatQuery prints the parsed query, so it's easy to compare in tests.
+func formatQuery(expr queryExpr) string {
+	switch e := expr.(type) {
+	case nil:
+		return ""
+	case queryAnd:
+		return "(" + formatQuery(e.left) + " AND " + formatQuery(e.right) + ")"
+	case queryOr:
+		return "(" + formatQuery(e.left) + " OR " + formatQuery(e.right) + ")"
+	case queryNot:
+		return "NOT " + formatQuery(e.expr)
+	case queryTerm:
+		value := e.value
+		if e.phrase {
+			value = `"` + value + `"`
+		}
+		if e.field != "" {
+			return e.field + ":" + value
+		}
+		return value
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"  golang  ", "golang"},
+		{"go lang", "(go AND lang)"},
+		{"go AND lang", "(go AND lang)"},
+		{`"exact phrase"`, `"exact phrase"`},
+		{"tag:go -tag:old", "(tag:go AND NOT tag:old)"},
+		{"#Go NOT #old", "(tag:go AND NOT tag:old)"},
+		{`tag:"Machine Learning"`, `tag:"machine learning"`},
+		{"#Dev/Go/ tag:/web", "(tag:dev/go AND tag:web)"},
+		{"site:GitHub.com", "site:github.com"},
+		{"after:2024-01-01 before:2024-02-01", "(after:2024-01-01 AND before:2024-02-01)"},
+		{"is:video", "is:video"},
+		{"a OR b c", "(a OR (b AND c))"},
+		{"a (b OR c)", "(a AND (b OR c))"},
+		{"NOT (a OR b)", "NOT (a OR b)"},
+		{"a or b", "((a AND or) AND b)"},
+		{"https://example.com", "https://example.com"},
+		{"10:30", "10:30"},
+		{
+			`tag:go -tag:old site:github.com after:2024-01-01 is:video "exact phrase"`,
+			`(((((tag:go AND NOT tag:old) AND site:github.com) AND after:2024-01-01) AND is:video) AND "exact phrase")`,
+		},
+	}
+
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("%q: got unexpected error: %v", tt.query, err)
+			continue
+		}
+
+		if got := formatQuery(query.expr); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`"exact phrase`, "position 1: missing closing quote"},
+		{"go -", "position 4: nothing to exclude"},
+		{"(go OR rust", "position 1: missing closing parenthesis"},
+		{"go)", `position 3: unexpected ")"`},
+		{"()", "position 1: empty parentheses"},
+		{"go OR", "position 6: missing term at the end"},
+		{"OR go", `position 1: expected term, got "OR"`},
+		{"go NOT", "position 7: missing term at the end"},
+		{"tag:/", "tag: needs a value"},
+		{"tag:", "tag: needs a value"},
+		{"tga:go", `unknown filter "tga:"`},
+		{"after:yesterday", "after: needs date in YYYY-MM-DD format"},
+		{"is:audio", `is: only supports "video"`},
+		{`""`, "empty phrase"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		if err == nil {
+			t.Errorf("%q: expected error, got nil", tt.query)
+			continue
+		}
+
+		if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected validation error containing %q, got %v", tt.query, tt.want, err)
+		}
+	}
+}
+
+func TestQueryWithTags(t *testing.T) {
+	query, _ := ParseQuery("golang")
+	query = query.WithTags("Go", " ", "web")
+
+	want := "((golang AND tag:go) AND tag:web)"
+	if got := formatQuery(query.expr); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	if !query.HasKeyword() {
+		t.Error("expected query to have keyword")
+	}
+
+	query = Query{}.WithTags("go")
+	if got := formatQuery(query.expr); got != "tag:go" || query.HasKeyword() {
+		t.Errorf("expected tag:go without keyword, got %s", got)
+	}
+}
+
+func TestQueryBuilderEscapesLike(t *testing.T) {
+	query, err := ParseQuery(`site:a_b%c!d.com 100%`)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+
+	args := []interface{}{}
+	qb := queryBuilder{
+		args:        &args,
+		placeholder: questionPlaceholder,
+		like:        "LIKE",
+		match:       func(placeholder string) string { return "MATCH " + placeholder },
+		matchArg:    func(term queryTerm) interface{} { return term.value },
+	}
+
+	where := qb.where(query)
+	if strings.Count(where, "LIKE ? ESCAPE '!'") != 5 {
+		t.Errorf("expected every LIKE to have ESCAPE clause, got %s", where)
+	}
+
+	want := []interface{}{
+		"%://a!_b!%c!!d.com", "%://a!_b!%c!!d.com/%", "%.a!_b!%c!!d.com", "%.a!_b!%c!!d.com/%",
+		"%100!%%", "100%",
+	}
+	if fmt.Sprint(args) != fmt.Sprint(want) {
+		t.Errorf("expected arguments %v, got %v", want, args)
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"html"
+	"strings"
+)
+
+// SortOrder is the order of bookmarks returned by SearchBookmarks.
+type SortOrder string
+
+// Supported sort orders. Relevance only makes sense when searching with keyword,
+// without it the bookmarks are sorted from the oldest.
+const (
+	SortRelevance SortOrder = "relevance"
+	SortNewest    SortOrder = "newest"
+	SortOldest    SortOrder = "oldest"
+	SortTitle     SortOrder = "title"
+)
+
+// ParseSortOrder converts the name of sort order into SortOrder.
+// Empty name is treated as SortRelevance.
+func ParseSortOrder(name string) (SortOrder, error) {
+	switch order := SortOrder(strings.ToLower(strings.TrimSpace(name))); order {
+	case "":
+		return SortRelevance, nil
+	case SortRelevance, SortNewest, SortOldest, SortTitle:
+		return order, nil
+	default:
+		return "", NewError(ErrValidation, "Sort must be one of relevance, newest, oldest or title")
+	}
+}
+
+// Page is the range of bookmarks to fetch. Zero Limit means all bookmarks are fetched,
+// in which case Offset is ignored.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// NewPage creates Page that contains limit bookmarks from the specified page number,
+// starting from 1. Zero limit means all bookmarks.
+func NewPage(limit, number int) (Page, error) {
+	if limit < 0 {
+		return Page{}, NewError(ErrValidation, "Limit must not be negative")
+	}
+
+	if number < 1 {
+		return Page{}, NewError(ErrValidation, "Page must be at least 1")
+	}
+
+	if limit == 0 && number > 1 {
+		return Page{}, NewError(ErrValidation, "Limit is required to fetch page other than the first")
+	}
+
+	return Page{Limit: limit, Offset: (number - 1) * limit}, nil
+}
+
+// Markers that wrap the matched terms in the snippet generated by database.
+// Control characters are used so they never clash with the page content.
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// highlightSnippet escapes the snippet generated by database
+// and wraps its matched terms with <mark>.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.Replace(snippet, snippetStart, "<mark>", -1)
+	snippet = strings.Replace(snippet, snippetStop, "</mark>", -1)
+	return snippet
+}
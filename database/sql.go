@@ -0,0 +1,1449 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/s-frostick/shiori/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sqlDialect is the part of SQL that differs between the supported databases,
+// e.g. the schema, full text search and how duplicate rows are ignored.
+type sqlDialect struct {
+	// migrations is the ordered list of schema changes, while legacyVersion detects
+	// the version of database created before schema versions were recorded (if any).
+	migrations    []Migration
+	legacyVersion legacyVersionFunc
+
+	// contentKey is the column of bookmark_content that refers to the bookmark. The
+	// content is saved by insertContent and updateContent, which use named parameters
+	// :id, :title, :content and :html, so they can be used more than once.
+	contentKey    string
+	insertContent string
+	updateContent string
+
+	// returningID gets the ID of new row using RETURNING clause, for driver that doesn't
+	// support LastInsertId. The table must have column named id.
+	returningID bool
+
+	// insertIgnore converts "INSERT INTO" statement into the one that silently
+	// skips the rows that violate unique constraint.
+	insertIgnore func(query string) string
+
+	// datetime converts the datetime column into "YYYY-MM-DD HH:MM:SS" text.
+	datetime func(column string) string
+
+	// like is the case-insensitive LIKE operator.
+	like string
+
+	// ftsRank returns subquery of bookmark_id, score and snippet of the bookmark content
+	// that matches any of the keywords, where higher score is more relevant. Its arguments
+	// are appended to args. ftsMatch returns the condition of bookmark b whose content
+	// matches the term bound to placeholder, while ftsArg converts the term into its argument.
+	ftsRank  func(keywords []queryTerm, args *[]interface{}) string
+	ftsMatch func(placeholder string) string
+	ftsArg   func(term queryTerm) interface{}
+
+	// uniqueViolation checks if err is caused by UNIQUE constraint.
+	uniqueViolation func(err error) bool
+}
+
+// sqlDatabase is implementation of Database interface that's shared by the SQL databases.
+// The queries are written with "?" placeholder and rebound for the driver before use,
+// while the parts that differ between databases are provided by the dialect.
+type sqlDatabase struct {
+	sqlx.DB
+	dialect   *sqlDialect
+	accountID int64
+}
+
+// Migrations returns every schema migration known by the database.
+func (db *sqlDatabase) Migrations() []Migration {
+	return db.dialect.migrations
+}
+
+// SchemaVersion returns the version of the latest migration applied to the database.
+func (db *sqlDatabase) SchemaVersion() (int, error) {
+	return schemaVersion(&db.DB, db.dialect.legacyVersion)
+}
+
+// Migrate applies all pending migrations and returns the applied ones.
+func (db *sqlDatabase) Migrate() ([]Migration, error) {
+	return migrate(&db.DB, db.dialect.migrations, db.dialect.legacyVersion)
+}
+
+// ForAccount returns the database limited to bookmarks and tags of the account.
+// Zero ID returns the database that can access every bookmark and tag.
+func (db *sqlDatabase) ForAccount(accountID int64) Database {
+	return &sqlDatabase{DB: db.DB, dialect: db.dialect, accountID: accountID}
+}
+
+// CreateBookmark saves new bookmark to database. Returns new ID and error if any happened.
+func (db *sqlDatabase) CreateBookmark(bookmark model.Bookmark) (int64, error) {
+	// Check URL and title
+	if bookmark.URL == "" {
+		return -1, NewError(ErrValidation, "URL must not be empty")
+	}
+
+	if bookmark.Title == "" {
+		return -1, NewError(ErrValidation, "Title must not be empty")
+	}
+
+	if bookmark.Modified == "" {
+		bookmark.Modified = time.Now().UTC().Format("2006-01-02 15:04:05")
+	}
+
+	// Prepare transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return -1, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Save article to database and get the new ID
+	bookmarkID, err := db.insert(tx, `INSERT INTO bookmark (
+		account_id, url, title, image_url, excerpt, author,
+		min_read_time, max_read_time, modified, isvideo, public)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		db.accountID,
+		bookmark.URL,
+		bookmark.Title,
+		bookmark.ImageURL,
+		bookmark.Excerpt,
+		bookmark.Author,
+		bookmark.MinReadTime,
+		bookmark.MaxReadTime,
+		bookmark.Modified,
+		bookmark.IsVideo,
+		bookmark.Public)
+	if db.dialect.uniqueViolation(err) {
+		return -1, NewError(ErrConflict, fmt.Sprintf("URL %s already exists", bookmark.URL))
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	// Save bookmark content
+	_, err = tx.NamedExec(db.dialect.insertContent, contentArgs(bookmarkID, bookmark))
+	if err != nil {
+		return -1, err
+	}
+
+	// Save tags
+	for _, tag := range bookmark.Tags {
+		tagName := strings.ToLower(tag.Name)
+		tagName = strings.TrimSpace(tagName)
+
+		err = db.addBookmarkTag(tx, bookmarkID, tagName)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+
+	return bookmarkID, nil
+}
+
+// CreateVideo saves new video to database. Returns new ID and error if any happened.
+func (db *sqlDatabase) CreateVideo(bookmarkID int64, video model.Video) (int64, error) {
+	// Prepare transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return -1, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Save video to database and get the new ID
+	videoID, err := db.insert(tx, `INSERT INTO video (
+		downloaded, filename)
+		VALUES(?, ?)`,
+		video.Downloaded,
+		video.Filename)
+	if err != nil {
+		return -1, err
+	}
+
+	_, err = tx.Exec(tx.Rebind(db.dialect.insertIgnore(
+		`INSERT INTO bookmark_video (video_id, bookmark_id) VALUES (?, ?)`)),
+		videoID, bookmarkID)
+	if err != nil {
+		return -1, err
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+
+	return videoID, nil
+}
+
+// GetBookmarks fetch list of bookmarks based on submitted indices.
+func (db *sqlDatabase) GetBookmarks(withContent bool, page Page, indices ...string) ([]model.Bookmark, error) {
+	// Parse indices into ranges of ID
+	ranges, err := parseIndices(indices)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare where clause, bookmarks in trash are excluded
+	args := []interface{}{}
+	whereClause := " WHERE deleted IS NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	if len(ranges) > 0 {
+		whereClause += " AND " + indexCondition("id", ranges, &args, questionPlaceholder)
+	}
+
+	// Fetch bookmarks in the requested page
+	query := `SELECT id,
+		url, title, image_url, excerpt, author, min_read_time, max_read_time,
+		` + db.dialect.datetime("modified") + ` modified, isvideo, public
+		FROM bookmark` + whereClause + ` ORDER BY id`
+
+	if page.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, page.Limit, page.Offset)
+	}
+
+	bookmarks := []model.Bookmark{}
+	err = db.Select(&bookmarks, db.Rebind(query), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Fetch tags and contents for each bookmarks
+	stmtGetTags, err := db.Preparex(db.Rebind(`SELECT t.id, t.name
+		FROM bookmark_tag bt LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id = ? ORDER BY t.name`))
+	if err != nil {
+		return nil, err
+	}
+
+	stmtGetContent, err := db.Preparex(db.Rebind(`SELECT title, content, html
+		FROM bookmark_content WHERE ` + db.dialect.contentKey + ` = ?`))
+	if err != nil {
+		return nil, err
+	}
+
+	defer stmtGetTags.Close()
+	defer stmtGetContent.Close()
+
+	for i, book := range bookmarks {
+		book.Tags = []model.Tag{}
+		err = stmtGetTags.Select(&book.Tags, book.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		if withContent {
+			err = stmtGetContent.Get(&book, book.ID)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		bookmarks[i] = book
+	}
+
+	return bookmarks, nil
+}
+
+// DeleteBookmarks moves all bookmarks with matching indices to trash.
+// If no indices submitted, every bookmark is moved to trash.
+func (db *sqlDatabase) DeleteBookmarks(indices ...string) error {
+	// Parse indices into ranges of ID
+	ranges, err := parseIndices(indices)
+	if err != nil {
+		return err
+	}
+
+	// Create args and where clause
+	deleted := time.Now().UTC().Format("2006-01-02 15:04:05")
+	args := []interface{}{deleted}
+	whereClause := " WHERE deleted IS NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	if len(ranges) > 0 {
+		whereClause += " AND " + indexCondition("id", ranges, &args, questionPlaceholder)
+	}
+
+	// Mark bookmarks as deleted
+	_, err = db.Exec(db.Rebind(`UPDATE bookmark SET deleted = ?`+whereClause), args...)
+	return err
+}
+
+// GetDeletedBookmarks fetch list of bookmarks in trash, the most recently deleted first.
+// Returns the bookmarks in the specified page and the count of all bookmarks in trash.
+func (db *sqlDatabase) GetDeletedBookmarks(page Page) ([]model.Bookmark, int, error) {
+	// Count all bookmarks in trash
+	args := []interface{}{}
+	whereClause := " WHERE deleted IS NOT NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	total := 0
+	err := db.Get(&total, db.Rebind(`SELECT COUNT(*) FROM bookmark`+whereClause), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+
+	// Fetch bookmarks in the requested page
+	query := `SELECT id,
+		url, title, image_url, excerpt, author, min_read_time, max_read_time,
+		` + db.dialect.datetime("modified") + ` modified, isvideo, public,
+		` + db.dialect.datetime("deleted") + ` deleted
+		FROM bookmark` + whereClause + ` ORDER BY deleted DESC, id`
+
+	if page.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, page.Limit, page.Offset)
+	}
+
+	bookmarks := []model.Bookmark{}
+	err = db.Select(&bookmarks, db.Rebind(query), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+
+	// Fetch tags for each bookmarks
+	err = db.fetchTags(bookmarks)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return bookmarks, total, nil
+}
+
+// RestoreBookmarks moves bookmarks with matching indices out of trash.
+// If no indices submitted, every bookmark in trash is restored.
+// Returns the count of restored bookmarks.
+func (db *sqlDatabase) RestoreBookmarks(indices ...string) (int, error) {
+	// Parse indices into ranges of ID
+	ranges, err := parseIndices(indices)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create args and where clause
+	args := []interface{}{}
+	whereClause := " WHERE deleted IS NOT NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	if len(ranges) > 0 {
+		whereClause += " AND " + indexCondition("id", ranges, &args, questionPlaceholder)
+	}
+
+	// Clear the deletion mark
+	res, err := db.Exec(db.Rebind(`UPDATE bookmark SET deleted = NULL`+whereClause), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	nRestored, err := res.RowsAffected()
+	return int(nRestored), err
+}
+
+// SetBookmarksPublic shares or stops sharing the bookmarks with matching indices, which decides
+// whether they can be read without login. Empty indices match every bookmark that's not in trash.
+// Returns the count of bookmarks that match the indices.
+func (db *sqlDatabase) SetBookmarksPublic(public bool, indices ...string) (int, error) {
+	ranges, err := parseIndices(indices)
+	if err != nil {
+		return 0, err
+	}
+
+	// Count the matching bookmarks first, since bookmarks that are
+	// already shared don't count as affected rows in MySQL
+	args := []interface{}{}
+	whereClause := " WHERE deleted IS NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	if len(ranges) > 0 {
+		whereClause += " AND " + indexCondition("id", ranges, &args, questionPlaceholder)
+	}
+
+	nBookmarks := 0
+	err = db.Get(&nBookmarks, db.Rebind(`SELECT COUNT(*) FROM bookmark`+whereClause), args...)
+	if err != nil || nBookmarks == 0 {
+		return 0, err
+	}
+
+	// Public flag comes first, followed by the arguments of where clause
+	_, err = db.Exec(db.Rebind(`UPDATE bookmark SET public = ?`+whereClause), append([]interface{}{public}, args...)...)
+	return nBookmarks, err
+}
+
+// GetVideoBookmarks returns IDs of the bookmarks that own the video file.
+// The file is shared by every bookmark of the same video, regardless of account.
+func (db *sqlDatabase) GetVideoBookmarks(filename string) ([]int64, error) {
+	bookmarkIDs := []int64{}
+	err := db.Select(&bookmarkIDs, db.Rebind(`SELECT DISTINCT bv.bookmark_id FROM bookmark_video bv
+		JOIN video v ON v.id = bv.video_id
+		WHERE v.filename = ? ORDER BY bv.bookmark_id`), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bookmarkIDs) == 0 {
+		return nil, NewError(ErrNotFound, "No bookmark owns the video")
+	}
+
+	return bookmarkIDs, nil
+}
+
+// PurgeBookmarks permanently removes bookmarks in trash with matching indices that were
+// deleted before the specified time. Zero time matches every bookmark in trash regardless
+// of its deletion time, and so does empty indices. Returns the count of removed bookmarks.
+func (db *sqlDatabase) PurgeBookmarks(deletedBefore time.Time, indices ...string) (int, error) {
+	// Parse indices into ranges of ID
+	ranges, err := parseIndices(indices)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create args and where clause
+	args := []interface{}{}
+	whereClause := " WHERE deleted IS NOT NULL" + accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+
+	if !deletedBefore.IsZero() {
+		args = append(args, deletedBefore.UTC().Format("2006-01-02 15:04:05"))
+		whereClause += " AND deleted < ?"
+	}
+
+	if len(ranges) > 0 {
+		whereClause += " AND " + indexCondition("id", ranges, &args, questionPlaceholder)
+	}
+
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Delete bookmarks. The child tables go first, while the bookmarks are still marked.
+	subQuery := "(SELECT id FROM bookmark" + whereClause + ")"
+	queries := []string{
+		"DELETE FROM bookmark_tag WHERE bookmark_id IN " + subQuery,
+		"DELETE FROM bookmark_content WHERE " + db.dialect.contentKey + " IN " + subQuery,
+		"DELETE FROM bookmark_video WHERE bookmark_id IN " + subQuery,
+	}
+
+	for _, query := range queries {
+		if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+			return 0, err
+		}
+	}
+
+	res, err := tx.Exec(tx.Rebind("DELETE FROM bookmark"+whereClause), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	nPurged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Commit transaction
+	return int(nPurged), tx.Commit()
+}
+
+// DeleteUnusedVideos removes the videos that aren't used by any bookmark anymore,
+// e.g. after their bookmarks are purged. Videos don't belong to any account, so it
+// removes them regardless of account. Returns the filenames that no video uses anymore.
+func (db *sqlDatabase) DeleteUnusedVideos() ([]string, error) {
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Remove the videos, remembering their files
+	unusedCondition := ` WHERE id NOT IN (SELECT video_id FROM bookmark_video)`
+	filenames := []string{}
+	err = tx.Select(&filenames, `SELECT DISTINCT filename FROM video`+unusedCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(filenames) == 0 {
+		return filenames, nil
+	}
+
+	_, err = tx.Exec(`DELETE FROM video` + unusedCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same file is shared by every video downloaded from the same URL
+	usedFilenames := []string{}
+	query, args, err := sqlx.In(`SELECT DISTINCT filename FROM video WHERE filename IN (?)`, filenames)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Select(&usedFilenames, tx.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	isUsed := map[string]bool{}
+	for _, filename := range usedFilenames {
+		isUsed[filename] = true
+	}
+
+	unusedFilenames := []string{}
+	for _, filename := range filenames {
+		if !isUsed[filename] {
+			unusedFilenames = append(unusedFilenames, filename)
+		}
+	}
+
+	// Commit transaction
+	return unusedFilenames, tx.Commit()
+}
+
+// SearchBookmarks search bookmarks that match the query, sorted by the specified order.
+// The words and phrases are matched against the full text index of the database,
+// which also ranks the bookmarks and makes the snippets of their content.
+// Returns the bookmarks in the specified page and the count of all matching bookmarks.
+func (db *sqlDatabase) SearchBookmarks(order SortOrder, page Page, query Query) ([]model.Bookmark, int, error) {
+	// Create initial variable
+	keywords := query.keywords()
+	selectSnippet := `'' snippet`
+	joinClause := ""
+	whereClause := " WHERE b.deleted IS NULL"
+	args := []interface{}{}
+
+	// Create join clause for ranking the keywords
+	if len(keywords) > 0 {
+		selectSnippet = `COALESCE(fts.snippet, '') snippet`
+		joinClause = ` LEFT JOIN (` + db.dialect.ftsRank(keywords, &args) + `) fts ON fts.bookmark_id = b.id`
+	}
+
+	// Create where clause for the query
+	whereClause += accountCondition("b.account_id", db.accountID, &args, questionPlaceholder)
+	builder := queryBuilder{
+		args:        &args,
+		placeholder: questionPlaceholder,
+		like:        db.dialect.like,
+		match:       db.dialect.ftsMatch,
+		matchArg:    db.dialect.ftsArg,
+	}
+	whereClause += builder.where(query)
+
+	// Search bookmarks
+	selectQuery := `SELECT b.id,
+		b.url, b.title, b.image_url, b.excerpt, b.author, b.min_read_time, b.max_read_time,
+		` + db.dialect.datetime("b.modified") + ` modified, b.isvideo, b.public, ` + selectSnippet + `
+		FROM bookmark b` + joinClause + whereClause
+
+	// Count all matching bookmarks, regardless of the page
+	total := 0
+	err := db.Get(&total, db.Rebind(`SELECT COUNT(*) FROM bookmark b`+joinClause+whereClause), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+
+	switch {
+	case order == SortNewest:
+		selectQuery += ` ORDER BY b.id DESC`
+	case order == SortTitle:
+		selectQuery += ` ORDER BY lower(b.title), b.id`
+	case order == SortRelevance && len(keywords) > 0:
+		selectQuery += ` ORDER BY fts.score IS NULL, fts.score DESC, b.id`
+	default:
+		selectQuery += ` ORDER BY b.id`
+	}
+
+	if page.Limit > 0 {
+		selectQuery += ` LIMIT ? OFFSET ?`
+		args = append(args, page.Limit, page.Offset)
+	}
+
+	bookmarks := []model.Bookmark{}
+	err = db.Select(&bookmarks, db.Rebind(selectQuery), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+
+	// Fetch tags for each bookmarks
+	err = db.fetchTags(bookmarks)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range bookmarks {
+		bookmarks[i].Snippet = highlightSnippet(bookmarks[i].Snippet)
+	}
+
+	return bookmarks, total, nil
+}
+
+// UpdateBookmarks updates the saved bookmark in database.
+func (db *sqlDatabase) UpdateBookmarks(bookmarks []model.Bookmark) ([]model.Bookmark, error) {
+	// Prepare transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Prepare statement
+	stmtUpdateBookmark, err := tx.Preparex(tx.Rebind(`UPDATE bookmark SET
+		url = ?, title = ?, image_url = ?, excerpt = ?, author = ?,
+		min_read_time = ?, max_read_time = ?, modified = ?, isvideo = ? WHERE id = ?`))
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
+
+	stmtUpdateBookmarkContent, err := tx.PrepareNamed(db.dialect.updateContent)
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
+
+	stmtDeleteBookmarkTag, err := tx.Preparex(tx.Rebind(`DELETE FROM bookmark_tag WHERE bookmark_id = ? AND tag_id = ?`))
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
+
+	result := []model.Bookmark{}
+	for _, book := range bookmarks {
+		// Make sure the bookmark belongs to the account and isn't in trash
+		args := []interface{}{book.ID}
+		nBookmark := 0
+		err = tx.Get(&nBookmark, tx.Rebind(`SELECT COUNT(*) FROM bookmark WHERE id = ? AND deleted IS NULL`+
+			accountCondition("account_id", db.accountID, &args, questionPlaceholder)), args...)
+		if err != nil {
+			return []model.Bookmark{}, err
+		}
+
+		if nBookmark == 0 {
+			return []model.Bookmark{}, NewError(ErrNotFound, fmt.Sprintf("Bookmark %d doesn't exist", book.ID))
+		}
+
+		_, err = stmtUpdateBookmark.Exec(
+			book.URL,
+			book.Title,
+			book.ImageURL,
+			book.Excerpt,
+			book.Author,
+			book.MinReadTime,
+			book.MaxReadTime,
+			book.Modified,
+			book.IsVideo,
+			book.ID)
+		if db.dialect.uniqueViolation(err) {
+			return []model.Bookmark{}, NewError(ErrConflict, fmt.Sprintf("URL %s already exists", book.URL))
+		}
+		if err != nil {
+			return []model.Bookmark{}, err
+		}
+
+		_, err = stmtUpdateBookmarkContent.Exec(contentArgs(book.ID, book))
+		if err != nil {
+			return []model.Bookmark{}, err
+		}
+
+		newTags := []model.Tag{}
+		for _, tag := range book.Tags {
+			if tag.Deleted {
+				_, err = stmtDeleteBookmarkTag.Exec(book.ID, tag.ID)
+				if err != nil {
+					return []model.Bookmark{}, err
+				}
+				continue
+			}
+
+			if tag.ID == 0 {
+				err = db.addBookmarkTag(tx, book.ID, tag.Name)
+				if err != nil {
+					return []model.Bookmark{}, err
+				}
+			}
+
+			newTags = append(newTags, tag)
+		}
+
+		book.Tags = newTags
+		result = append(result, book)
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return []model.Bookmark{}, err
+	}
+
+	return result, nil
+}
+
+// CreateAccount saves new account to database. The first account takes the bookmarks
+// and tags that were saved without owner, since nobody could see them otherwise.
+func (db *sqlDatabase) CreateAccount(username, password string, role Role) error {
+	// Hash password with bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Insert account to database. The hash is stored as text,
+	// otherwise lib/pq will send it as bytea.
+	accountID, err := db.insert(tx, `INSERT INTO account
+		(username, password, role) VALUES (?, ?, ?)`,
+		username, string(hashedPassword), role)
+	if db.dialect.uniqueViolation(err) {
+		return NewError(ErrConflict, fmt.Sprintf("Username %s already exists", username))
+	}
+	if err != nil {
+		return err
+	}
+
+	nAccounts := 0
+	err = tx.Get(&nAccounts, `SELECT COUNT(*) FROM account`)
+	if err != nil {
+		return err
+	}
+
+	if nAccounts == 1 {
+		for _, query := range []string{
+			`UPDATE bookmark SET account_id = ? WHERE account_id = 0`,
+			`UPDATE tag SET account_id = ? WHERE account_id = 0`,
+		} {
+			if _, err = tx.Exec(tx.Rebind(query), accountID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetAccounts fetch list of accounts in database
+func (db *sqlDatabase) GetAccounts(keyword string, exact bool) ([]model.Account, error) {
+	query := `SELECT id, username, password, role FROM account`
+	args := []interface{}{}
+	if keyword != "" {
+		if exact {
+			query += ` WHERE username = ?`
+			args = append(args, keyword)
+		} else {
+			query += ` WHERE username LIKE ?`
+			args = append(args, "%"+keyword+"%")
+		}
+	}
+	query += ` ORDER BY username`
+
+	accounts := []model.Account{}
+	err := db.Select(&accounts, db.Rebind(query), args...)
+	return accounts, err
+}
+
+// GetAccount fetch the account with the specified ID
+func (db *sqlDatabase) GetAccount(id int64) (model.Account, error) {
+	account := model.Account{}
+	err := db.Get(&account, db.Rebind(`SELECT id, username, password, role
+		FROM account WHERE id = ?`), id)
+	if err == sql.ErrNoRows {
+		return account, NewError(ErrNotFound, fmt.Sprintf("Account %d doesn't exist", id))
+	}
+
+	return account, err
+}
+
+// DeleteAccounts removes all record with matching usernames, along with their tags, sessions and API tokens.
+// Accounts that still own bookmarks are refused, so no bookmark is left without owner.
+func (db *sqlDatabase) DeleteAccounts(usernames ...string) error {
+	// Prepare where clause
+	args := []interface{}{}
+	whereClause := " WHERE 1 = 1"
+
+	if len(usernames) > 0 {
+		whereClause = " WHERE username IN ("
+		for _, username := range usernames {
+			args = append(args, username)
+			whereClause += "?,"
+		}
+
+		whereClause = whereClause[:len(whereClause)-1]
+		whereClause += ")"
+	}
+
+	// Refuse the accounts that still own bookmarks
+	accountIDs := "SELECT id FROM account" + whereClause
+	nBookmarks := 0
+	err := db.Get(&nBookmarks, db.Rebind(`SELECT COUNT(*) FROM bookmark WHERE account_id IN (`+accountIDs+`)`), args...)
+	if err != nil {
+		return err
+	}
+
+	if nBookmarks > 0 {
+		return NewError(ErrConflict, "Account still owns bookmarks, delete them and empty the trash first")
+	}
+
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Delete the tags, sessions and API tokens of accounts, then the accounts.
+	// The parents of tags are cleared first so the tags can be deleted in any order.
+	queries := []string{
+		`UPDATE tag SET parent_id = NULL WHERE account_id IN (` + accountIDs + `)`,
+		`DELETE FROM tag WHERE account_id IN (` + accountIDs + `)`,
+		`DELETE FROM session WHERE account_id IN (` + accountIDs + `)`,
+		`DELETE FROM api_token WHERE account_id IN (` + accountIDs + `)`,
+		`DELETE FROM account` + whereClause,
+	}
+
+	for _, query := range queries {
+		if _, err = tx.Exec(tx.Rebind(query), args...); err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// SetAccountRole changes the role of account with matching username.
+func (db *sqlDatabase) SetAccountRole(username string, role Role) error {
+	// Make sure the account exists, since updating the row with
+	// its current role doesn't count as affected row in MySQL
+	accountID := int64(0)
+	err := db.Get(&accountID, db.Rebind(`SELECT id FROM account WHERE username = ?`), username)
+	if err == sql.ErrNoRows {
+		return NewError(ErrNotFound, fmt.Sprintf("Account %s doesn't exist", username))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(db.Rebind(`UPDATE account SET role = ? WHERE id = ?`), role, accountID)
+	return err
+}
+
+// SetAccountPassword changes the password of account with matching username.
+func (db *sqlDatabase) SetAccountPassword(username, password string) error {
+	// Hash password with bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+
+	// Make sure the account exists
+	accountID := int64(0)
+	err = db.Get(&accountID, db.Rebind(`SELECT id FROM account WHERE username = ?`), username)
+	if err == sql.ErrNoRows {
+		return NewError(ErrNotFound, fmt.Sprintf("Account %s doesn't exist", username))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(db.Rebind(`UPDATE account SET password = ? WHERE id = ?`), string(hashedPassword), accountID)
+	return err
+}
+
+// CreateSession records new login session, and removes the expired ones.
+func (db *sqlDatabase) CreateSession(session model.Session) error {
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	_, err = tx.Exec(tx.Rebind(`DELETE FROM session WHERE expires <= ?`), now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(tx.Rebind(`INSERT INTO session
+		(id, account_id, created, expires) VALUES (?, ?, ?, ?)`),
+		session.ID, session.AccountID, session.Created, session.Expires)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// GetSession fetch the session with the specified ID, if it hasn't expired.
+func (db *sqlDatabase) GetSession(id string) (model.Session, error) {
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	session := model.Session{}
+	err := db.Get(&session, db.Rebind(`SELECT s.id, s.account_id, a.username,
+		`+db.dialect.datetime("s.created")+` created, `+db.dialect.datetime("s.expires")+` expires
+		FROM session s JOIN account a ON a.id = s.account_id
+		WHERE s.id = ? AND s.expires > ?`), id, now)
+	if err == sql.ErrNoRows {
+		return session, NewError(ErrNotFound, "Session doesn't exist or has expired")
+	}
+
+	return session, err
+}
+
+// GetSessions fetch the sessions of account that haven't expired, the newest first.
+// Zero accountID fetch the sessions of every account.
+func (db *sqlDatabase) GetSessions(accountID int64) ([]model.Session, error) {
+	args := []interface{}{time.Now().UTC().Format("2006-01-02 15:04:05")}
+	whereClause := " WHERE s.expires > ?" + accountCondition("s.account_id", accountID, &args, questionPlaceholder)
+
+	sessions := []model.Session{}
+	err := db.Select(&sessions, db.Rebind(`SELECT s.id, s.account_id, a.username,
+		`+db.dialect.datetime("s.created")+` created, `+db.dialect.datetime("s.expires")+` expires
+		FROM session s JOIN account a ON a.id = s.account_id`+whereClause+`
+		ORDER BY s.created DESC, s.id`), args...)
+	return sessions, err
+}
+
+// DeleteSessions revokes the sessions of account with matching IDs. If no ID is submitted,
+// every session of the account is revoked. Zero accountID matches every account.
+// Returns the number of revoked sessions.
+func (db *sqlDatabase) DeleteSessions(accountID int64, ids ...string) (int, error) {
+	args := []interface{}{}
+	whereClause := " WHERE 1 = 1" + accountCondition("account_id", accountID, &args, questionPlaceholder)
+
+	if len(ids) > 0 {
+		whereClause += " AND id IN ("
+		for _, id := range ids {
+			args = append(args, id)
+			whereClause += "?,"
+		}
+
+		whereClause = whereClause[:len(whereClause)-1]
+		whereClause += ")"
+	}
+
+	res, err := db.Exec(db.Rebind(`DELETE FROM session`+whereClause), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	nDeleted, err := res.RowsAffected()
+	return int(nDeleted), err
+}
+
+// CreateAPIToken saves new API token. Returns the token with its new ID.
+func (db *sqlDatabase) CreateAPIToken(token model.APIToken) (model.APIToken, error) {
+	var err error
+	token.ID, err = db.insert(&db.DB, `INSERT INTO api_token
+		(account_id, name, hash, read_only, created) VALUES (?, ?, ?, ?, ?)`,
+		token.AccountID, token.Name, token.Hash, token.ReadOnly, token.Created)
+	if db.dialect.uniqueViolation(err) {
+		return token, NewError(ErrConflict, fmt.Sprintf("Token %s already exists", token.Name))
+	}
+
+	return token, err
+}
+
+// UseAPIToken fetch the API token with matching hash, and records that it's used now.
+func (db *sqlDatabase) UseAPIToken(hash string) (model.APIToken, error) {
+	token := model.APIToken{}
+	err := db.Get(&token, db.Rebind(`SELECT t.id, t.account_id, a.username, t.name, t.hash, t.read_only,
+		`+db.dialect.datetime("t.created")+` created,
+		COALESCE(`+db.dialect.datetime("t.last_used")+`, '') last_used
+		FROM api_token t JOIN account a ON a.id = t.account_id
+		WHERE t.hash = ?`), hash)
+	if err == sql.ErrNoRows {
+		return token, NewError(ErrNotFound, "Token doesn't exist")
+	}
+	if err != nil {
+		return token, err
+	}
+
+	token.LastUsed = time.Now().UTC().Format("2006-01-02 15:04:05")
+	_, err = db.Exec(db.Rebind(`UPDATE api_token SET last_used = ? WHERE id = ?`), token.LastUsed, token.ID)
+	return token, err
+}
+
+// GetAPITokens fetch the API tokens of account, ordered by name.
+// Zero accountID fetch the API tokens of every account.
+func (db *sqlDatabase) GetAPITokens(accountID int64) ([]model.APIToken, error) {
+	args := []interface{}{}
+	whereClause := " WHERE 1 = 1" + accountCondition("t.account_id", accountID, &args, questionPlaceholder)
+
+	tokens := []model.APIToken{}
+	err := db.Select(&tokens, db.Rebind(`SELECT t.id, t.account_id, a.username, t.name, t.hash, t.read_only,
+		`+db.dialect.datetime("t.created")+` created,
+		COALESCE(`+db.dialect.datetime("t.last_used")+`, '') last_used
+		FROM api_token t JOIN account a ON a.id = t.account_id`+whereClause+`
+		ORDER BY a.username, t.name`), args...)
+	return tokens, err
+}
+
+// DeleteAPITokens revokes the API tokens of account with matching IDs. If no ID is submitted,
+// every API token of the account is revoked. Zero accountID matches every account.
+// Returns the number of revoked tokens.
+func (db *sqlDatabase) DeleteAPITokens(accountID int64, ids ...int64) (int, error) {
+	args := []interface{}{}
+	whereClause := " WHERE 1 = 1" + accountCondition("account_id", accountID, &args, questionPlaceholder)
+
+	if len(ids) > 0 {
+		whereClause += " AND id IN ("
+		for _, id := range ids {
+			args = append(args, id)
+			whereClause += "?,"
+		}
+
+		whereClause = whereClause[:len(whereClause)-1]
+		whereClause += ")"
+	}
+
+	res, err := db.Exec(db.Rebind(`DELETE FROM api_token`+whereClause), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	nDeleted, err := res.RowsAffected()
+	return int(nDeleted), err
+}
+
+// CreateAuthEvent saves new event into audit log of logins.
+func (db *sqlDatabase) CreateAuthEvent(event model.AuthEvent) error {
+	_, err := db.Exec(db.Rebind(`INSERT INTO auth_event
+		(event, username, address, message, created) VALUES (?, ?, ?, ?, ?)`),
+		event.Event, event.Username, event.Address, event.Message, event.Created)
+	return err
+}
+
+// GetAuthEvents fetch the events in audit log of logins, the newest first.
+// Empty username fetch the events of every username.
+func (db *sqlDatabase) GetAuthEvents(username string, page Page) ([]model.AuthEvent, error) {
+	query := `SELECT id, event, username, address, message,
+		` + db.dialect.datetime("created") + ` created FROM auth_event`
+	args := []interface{}{}
+	if username != "" {
+		args = append(args, username)
+		query += ` WHERE username = ?`
+	}
+	query += ` ORDER BY id DESC`
+
+	if page.Limit > 0 {
+		args = append(args, page.Limit, page.Offset)
+		query += ` LIMIT ? OFFSET ?`
+	}
+
+	events := []model.AuthEvent{}
+	err := db.Select(&events, db.Rebind(query), args...)
+	return events, err
+}
+
+// GetTags fetch list of tags and the count of bookmarks that use them,
+// including the unused tags. Bookmarks in trash are not counted.
+func (db *sqlDatabase) GetTags() ([]model.Tag, error) {
+	args := []interface{}{}
+	query := `SELECT t.id, t.name, COALESCE(t.parent_id, 0) parent_id, COUNT(b.id) n_bookmarks
+		FROM tag t
+		LEFT JOIN bookmark_tag bt ON bt.tag_id = t.id
+		LEFT JOIN bookmark b ON bt.bookmark_id = b.id AND b.deleted IS NULL
+		WHERE 1 = 1` + accountCondition("t.account_id", db.accountID, &args, questionPlaceholder) + `
+		GROUP BY t.id, t.name, t.parent_id ORDER BY t.name`
+
+	tags := []model.Tag{}
+	err := db.Select(&tags, db.Rebind(query), args...)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// RenameTag changes the name of tag with the specified ID. The descendants are moved
+// along with the tag, and the missing ancestors of the new name are created.
+// Returns the renamed tag and error if any happened.
+func (db *sqlDatabase) RenameTag(id int64, name string) (model.Tag, error) {
+	name = NormalizeTagName(name)
+	if name == "" {
+		return model.Tag{}, NewError(ErrValidation, "Tag name must not be empty")
+	}
+
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Make sure the tag exists
+	oldName, accountID := "", int64(0)
+	args := []interface{}{id}
+	err = tx.QueryRow(tx.Rebind(`SELECT name, account_id FROM tag WHERE id = ?`+
+		accountCondition("account_id", db.accountID, &args, questionPlaceholder)), args...).Scan(&oldName, &accountID)
+	if err == sql.ErrNoRows {
+		return model.Tag{}, NewError(ErrNotFound, fmt.Sprintf("Tag %d doesn't exist", id))
+	}
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	prefix, prefixLength := descendantPrefix(oldName)
+	if strings.HasPrefix(name, prefix) {
+		return model.Tag{}, NewError(ErrValidation, fmt.Sprintf("Tag %s can't be moved into its own child", oldName))
+	}
+
+	// Find the new parent, creating it if needed
+	parentID := sql.NullInt64{}
+	if parentName := parentTagName(name); parentName != "" {
+		parentID.Int64, err = db.getTagID(tx, accountID, parentName)
+		if err != nil {
+			return model.Tag{}, err
+		}
+		parentID.Valid = true
+	}
+
+	_, err = tx.Exec(tx.Rebind(`UPDATE tag SET name = ?, parent_id = ? WHERE id = ?`), name, parentID, id)
+	if db.dialect.uniqueViolation(err) {
+		return model.Tag{}, NewError(ErrConflict, fmt.Sprintf("Tag %s already exists, merge the tags instead", name))
+	}
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	// Move the descendants along with the tag
+	descendants := []model.Tag{}
+	err = tx.Select(&descendants, tx.Rebind(`SELECT id, name FROM tag
+		WHERE account_id = ? AND substr(name, 1, ?) = ?`),
+		accountID, prefixLength, prefix)
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	for _, tag := range descendants {
+		newName := name + strings.TrimPrefix(tag.Name, oldName)
+		_, err = tx.Exec(tx.Rebind(`UPDATE tag SET name = ? WHERE id = ?`), newName, tag.ID)
+		if db.dialect.uniqueViolation(err) {
+			return model.Tag{}, NewError(ErrConflict, fmt.Sprintf("Tag %s already exists, merge the tags instead", newName))
+		}
+		if err != nil {
+			return model.Tag{}, err
+		}
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return model.Tag{}, err
+	}
+
+	return model.Tag{ID: id, Name: name, ParentID: parentID.Int64}, nil
+}
+
+// MergeTags moves the bookmarks of source tags into the target tag, then removes the source tags.
+// Tag that has child tags can't be merged, since its children would lose their parent.
+func (db *sqlDatabase) MergeTags(targetID int64, sourceIDs ...int64) error {
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Make sure the target exists
+	targetAccountID := int64(0)
+	args := []interface{}{targetID}
+	err = tx.Get(&targetAccountID, tx.Rebind(`SELECT account_id FROM tag WHERE id = ?`+
+		accountCondition("account_id", db.accountID, &args, questionPlaceholder)), args...)
+	if err == sql.ErrNoRows {
+		return NewError(ErrNotFound, fmt.Sprintf("Tag %d doesn't exist", targetID))
+	}
+	if err != nil {
+		return err
+	}
+
+	// Move bookmarks of each source tag, skipping the ones that already have the target
+	for _, sourceID := range sourceIDs {
+		if sourceID == targetID {
+			continue
+		}
+
+		accountID := int64(0)
+		args := []interface{}{sourceID}
+		err = tx.Get(&accountID, tx.Rebind(`SELECT account_id FROM tag WHERE id = ?`+
+			accountCondition("account_id", db.accountID, &args, questionPlaceholder)), args...)
+		if err == sql.ErrNoRows {
+			return NewError(ErrNotFound, fmt.Sprintf("Tag %d doesn't exist", sourceID))
+		}
+		if err != nil {
+			return err
+		}
+
+		if accountID != targetAccountID {
+			return NewError(ErrValidation, "Tags of different accounts can't be merged")
+		}
+
+		nChild := 0
+		err = tx.Get(&nChild, tx.Rebind(`SELECT COUNT(*) FROM tag WHERE parent_id = ?`), sourceID)
+		if err != nil {
+			return err
+		}
+
+		if nChild > 0 {
+			return NewError(ErrValidation, fmt.Sprintf("Tag %d has child tags, merge or delete them first", sourceID))
+		}
+
+		_, err = tx.Exec(tx.Rebind(db.dialect.insertIgnore(`INSERT INTO bookmark_tag (bookmark_id, tag_id)
+			SELECT bookmark_id, ? FROM bookmark_tag WHERE tag_id = ?`)), targetID, sourceID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(tx.Rebind(`DELETE FROM bookmark_tag WHERE tag_id = ?`), sourceID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(tx.Rebind(`DELETE FROM tag WHERE id = ?`), sourceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// DeleteTags removes tags with the specified IDs along with their descendants,
+// detaching them from their bookmarks.
+func (db *sqlDatabase) DeleteTags(ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Begin transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// Make sure to rollback if something failed
+	defer tx.Rollback()
+
+	// Collect the tags and their descendants
+	tagNames := map[int64]string{}
+	for _, id := range ids {
+		name, accountID := "", int64(0)
+		args := []interface{}{id}
+		err = tx.QueryRow(tx.Rebind(`SELECT name, account_id FROM tag WHERE id = ?`+
+			accountCondition("account_id", db.accountID, &args, questionPlaceholder)), args...).Scan(&name, &accountID)
+		if err == sql.ErrNoRows {
+			return NewError(ErrNotFound, "Some of the tags don't exist")
+		}
+		if err != nil {
+			return err
+		}
+
+		descendants := []model.Tag{}
+		prefix, prefixLength := descendantPrefix(name)
+		err = tx.Select(&descendants, tx.Rebind(`SELECT id, name FROM tag
+			WHERE account_id = ? AND substr(name, 1, ?) = ?`),
+			accountID, prefixLength, prefix)
+		if err != nil {
+			return err
+		}
+
+		tagNames[id] = name
+		for _, tag := range descendants {
+			tagNames[tag.ID] = tag.Name
+		}
+	}
+
+	// Delete the deepest tags first, so no parent is removed before its children
+	tags := []model.Tag{}
+	for id, name := range tagNames {
+		tags = append(tags, model.Tag{ID: id, Name: name})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return len(tags[i].Name) > len(tags[j].Name)
+	})
+
+	for _, tag := range tags {
+		_, err = tx.Exec(tx.Rebind(`DELETE FROM bookmark_tag WHERE tag_id = ?`), tag.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(tx.Rebind(`DELETE FROM tag WHERE id = ?`), tag.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// PruneTags removes tags that are not used by any bookmark, including the bookmarks
+// in trash, and don't have any child tag left. Returns the count of removed tags.
+func (db *sqlDatabase) PruneTags() (int, error) {
+	// The parents are selected through derived table,
+	// since MySQL can't select from the table being deleted.
+	args := []interface{}{}
+	query := `DELETE FROM tag WHERE id NOT IN (SELECT tag_id FROM bookmark_tag)
+		AND id NOT IN (SELECT parent_id FROM (
+			SELECT parent_id FROM tag WHERE parent_id IS NOT NULL) parent)`
+	query += accountCondition("account_id", db.accountID, &args, questionPlaceholder)
+	query = db.Rebind(query)
+
+	// Removing the children may leave their parent unused, so repeat until nothing is removed
+	nPruned := 0
+	for {
+		res, err := db.Exec(query, args...)
+		if err != nil {
+			return nPruned, err
+		}
+
+		nDeleted, err := res.RowsAffected()
+		if err != nil {
+			return nPruned, err
+		}
+
+		if nDeleted == 0 {
+			return nPruned, nil
+		}
+
+		nPruned += int(nDeleted)
+	}
+}
+
+// fetchTags fills the tags of each bookmark.
+func (db *sqlDatabase) fetchTags(bookmarks []model.Bookmark) error {
+	stmtGetTags, err := db.Preparex(db.Rebind(`SELECT t.id, t.name
+		FROM bookmark_tag bt LEFT JOIN tag t ON bt.tag_id = t.id
+		WHERE bt.bookmark_id = ? ORDER BY t.name`))
+	if err != nil {
+		return err
+	}
+	defer stmtGetTags.Close()
+
+	for i := range bookmarks {
+		tags := []model.Tag{}
+		err = stmtGetTags.Select(&tags, bookmarks[i].ID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		bookmarks[i].Tags = tags
+	}
+
+	return nil
+}
+
+// addBookmarkTag attaches tag with the specified name to the bookmark, creating the tag
+// first if it doesn't exist yet. The tag belongs to the owner of bookmark. Empty name is ignored.
+func (db *sqlDatabase) addBookmarkTag(tx *sqlx.Tx, bookmarkID int64, tagName string) error {
+	tagName = NormalizeTagName(tagName)
+	if tagName == "" {
+		return nil
+	}
+
+	accountID := int64(0)
+	err := tx.Get(&accountID, tx.Rebind(`SELECT account_id FROM bookmark WHERE id = ?`), bookmarkID)
+	if err != nil {
+		return err
+	}
+
+	tagID, err := db.getTagID(tx, accountID, tagName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(tx.Rebind(db.dialect.insertIgnore(
+		`INSERT INTO bookmark_tag (tag_id, bookmark_id) VALUES (?, ?)`)),
+		tagID, bookmarkID)
+	return err
+}
+
+// getTagID returns ID of the account's tag with the specified name, creating
+// the tag and its missing ancestors first if they don't exist yet.
+func (db *sqlDatabase) getTagID(tx *sqlx.Tx, accountID int64, tagName string) (int64, error) {
+	tagID := int64(-1)
+	err := tx.Get(&tagID, tx.Rebind(`SELECT id FROM tag WHERE account_id = ? AND name = ?`), accountID, tagName)
+	if err != nil && err != sql.ErrNoRows {
+		return -1, err
+	}
+
+	if tagID != -1 {
+		return tagID, nil
+	}
+
+	parentID := sql.NullInt64{}
+	if parentName := parentTagName(tagName); parentName != "" {
+		parentID.Int64, err = db.getTagID(tx, accountID, parentName)
+		if err != nil {
+			return -1, err
+		}
+		parentID.Valid = true
+	}
+
+	return db.insert(tx, `INSERT INTO tag (account_id, name, parent_id) VALUES (?, ?, ?)`,
+		accountID, tagName, parentID)
+}
+
+// insert executes the INSERT statement and returns the ID of new row.
+func (db *sqlDatabase) insert(e sqlx.Ext, query string, args ...interface{}) (int64, error) {
+	if db.dialect.returningID {
+		id := int64(-1)
+		err := sqlx.Get(e, &id, e.Rebind(query+` RETURNING id`), args...)
+		return id, err
+	}
+
+	res, err := e.Exec(e.Rebind(query), args...)
+	if err != nil {
+		return -1, err
+	}
+
+	return res.LastInsertId()
+}
+
+// contentArgs returns the named arguments of insertContent and updateContent.
+func contentArgs(bookmarkID int64, bookmark model.Bookmark) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      bookmarkID,
+		"title":   bookmark.Title,
+		"content": bookmark.Content,
+		"html":    bookmark.HTML,
+	}
+}
@@ -0,0 +1,263 @@
+package database
+
+import "github.com/jmoiron/sqlx"
+
+// sqliteMigrations is the ordered list of schema changes for SQLite database.
+// Never edit a migration that has been released, add a new one instead.
+var sqliteMigrations = []Migration{{
+	Version:     1,
+	Description: "Create initial tables",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS account(
+		id INTEGER NOT NULL,
+		username TEXT NOT NULL,
+		password TEXT NOT NULL,
+		CONSTRAINT account_PK PRIMARY KEY(id),
+		CONSTRAINT account_username_UNIQUE UNIQUE(username))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark(
+		id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT "",
+		excerpt TEXT NOT NULL DEFAULT "",
+		author TEXT NOT NULL DEFAULT "",
+		min_read_time INTEGER NOT NULL DEFAULT 0,
+		max_read_time INTEGER NOT NULL DEFAULT 0,
+		modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT bookmark_PK PRIMARY KEY(id),
+		CONSTRAINT bookmark_url_UNIQUE UNIQUE(url))`,
+
+		`CREATE TABLE IF NOT EXISTS tag(
+		id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		CONSTRAINT tag_PK PRIMARY KEY(id),
+		CONSTRAINT tag_name_UNIQUE UNIQUE(name))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_tag(
+		bookmark_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		CONSTRAINT bookmark_tag_PK PRIMARY KEY(bookmark_id, tag_id),
+		CONSTRAINT bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id))`,
+
+		`CREATE VIRTUAL TABLE IF NOT EXISTS bookmark_content USING fts4(title, content, html)`,
+	},
+}, {
+	Version:     2,
+	Description: "Add video support",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN isvideo INTEGER NOT NULL DEFAULT 0`,
+
+		`CREATE TABLE IF NOT EXISTS video(
+		id INTEGER NOT NULL,
+		downloaded INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		CONSTRAINT video_PK PRIMARY KEY(id))`,
+
+		`CREATE TABLE IF NOT EXISTS bookmark_video(
+		bookmark_id INTEGER NOT NULL,
+		video_id INTEGER NOT NULL,
+		CONSTRAINT bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+		CONSTRAINT video_id_FK FOREIGN KEY(video_id) REFERENCES video(id))`,
+	},
+}, {
+	Version:     3,
+	Description: "Use FTS5 for bookmark content",
+	statements: []string{
+		`CREATE VIRTUAL TABLE bookmark_content_fts5 USING fts5(title, content, html UNINDEXED)`,
+
+		`INSERT INTO bookmark_content_fts5 (rowid, title, content, html)
+		SELECT docid, title, content, html FROM bookmark_content`,
+
+		`DROP TABLE bookmark_content`,
+
+		`ALTER TABLE bookmark_content_fts5 RENAME TO bookmark_content`,
+	},
+}, {
+	Version:     4,
+	Description: "Add trash for deleted bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN deleted TEXT DEFAULT NULL`,
+		`CREATE INDEX bookmark_deleted_IDX ON bookmark(deleted)`,
+	},
+}, {
+	// Without AUTOINCREMENT, SQLite reuses the ID of the last bookmark
+	// once it's purged, so the table is rebuilt to keep the IDs stable.
+	Version:     5,
+	Description: "Never reuse bookmark ID",
+	statements: []string{
+		`CREATE TABLE bookmark_autoincrement(
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT "",
+		excerpt TEXT NOT NULL DEFAULT "",
+		author TEXT NOT NULL DEFAULT "",
+		min_read_time INTEGER NOT NULL DEFAULT 0,
+		max_read_time INTEGER NOT NULL DEFAULT 0,
+		modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		isvideo INTEGER NOT NULL DEFAULT 0,
+		deleted TEXT DEFAULT NULL,
+		CONSTRAINT bookmark_url_UNIQUE UNIQUE(url))`,
+
+		`INSERT INTO bookmark_autoincrement (id, url, title, image_url, excerpt, author,
+		min_read_time, max_read_time, modified, isvideo, deleted)
+		SELECT id, url, title, image_url, excerpt, author,
+		min_read_time, max_read_time, modified, isvideo, deleted FROM bookmark`,
+
+		`DROP TABLE bookmark`,
+
+		`ALTER TABLE bookmark_autoincrement RENAME TO bookmark`,
+
+		`CREATE INDEX bookmark_deleted_IDX ON bookmark(deleted)`,
+	},
+}, {
+	Version:     6,
+	Description: "Add parent of hierarchical tag",
+	statements: []string{
+		`ALTER TABLE tag ADD COLUMN parent_id INTEGER DEFAULT NULL REFERENCES tag(id)`,
+		`CREATE INDEX tag_parent_id_IDX ON tag(parent_id)`,
+	},
+}, {
+	// URL and tag name become unique per account, which needs the tables to be rebuilt.
+	// Existing bookmarks and tags are given to the oldest account, if there's any.
+	Version:     7,
+	Description: "Add owner of bookmarks and tags",
+	statements: []string{
+		`CREATE TABLE bookmark_account(
+		id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		account_id INTEGER NOT NULL DEFAULT 0,
+		url TEXT NOT NULL,
+		title TEXT NOT NULL,
+		image_url TEXT NOT NULL DEFAULT "",
+		excerpt TEXT NOT NULL DEFAULT "",
+		author TEXT NOT NULL DEFAULT "",
+		min_read_time INTEGER NOT NULL DEFAULT 0,
+		max_read_time INTEGER NOT NULL DEFAULT 0,
+		modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		isvideo INTEGER NOT NULL DEFAULT 0,
+		deleted TEXT DEFAULT NULL,
+		CONSTRAINT bookmark_url_UNIQUE UNIQUE(account_id, url))`,
+
+		`INSERT INTO bookmark_account (id, account_id, url, title, image_url, excerpt, author,
+		min_read_time, max_read_time, modified, isvideo, deleted)
+		SELECT id, COALESCE((SELECT MIN(id) FROM account), 0), url, title, image_url, excerpt, author,
+		min_read_time, max_read_time, modified, isvideo, deleted FROM bookmark`,
+
+		// Keep the sequence, so the ID of purged bookmarks is not reused
+		`DELETE FROM sqlite_sequence WHERE name = 'bookmark_account'`,
+
+		`INSERT INTO sqlite_sequence (name, seq)
+		SELECT 'bookmark_account', seq FROM sqlite_sequence WHERE name = 'bookmark'`,
+
+		`DROP TABLE bookmark`,
+
+		`ALTER TABLE bookmark_account RENAME TO bookmark`,
+
+		`CREATE INDEX bookmark_deleted_IDX ON bookmark(deleted)`,
+
+		`CREATE TABLE tag_account(
+		id INTEGER NOT NULL,
+		account_id INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL,
+		parent_id INTEGER DEFAULT NULL REFERENCES tag(id),
+		CONSTRAINT tag_PK PRIMARY KEY(id),
+		CONSTRAINT tag_name_UNIQUE UNIQUE(account_id, name))`,
+
+		`INSERT INTO tag_account (id, account_id, name, parent_id)
+		SELECT id, COALESCE((SELECT MIN(id) FROM account), 0), name, parent_id FROM tag`,
+
+		`DROP TABLE tag`,
+
+		`ALTER TABLE tag_account RENAME TO tag`,
+
+		`CREATE INDEX tag_parent_id_IDX ON tag(parent_id)`,
+	},
+}, {
+	// Existing accounts keep managing everything as admin.
+	Version:     8,
+	Description: "Add role of accounts",
+	statements: []string{
+		`ALTER TABLE account ADD COLUMN role TEXT NOT NULL DEFAULT 'editor'`,
+		`UPDATE account SET role = 'admin'`,
+	},
+}, {
+	Version:     9,
+	Description: "Add login sessions",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS session(
+		id TEXT NOT NULL,
+		account_id INTEGER NOT NULL,
+		created TEXT NOT NULL,
+		expires TEXT NOT NULL,
+		CONSTRAINT session_PK PRIMARY KEY(id),
+		CONSTRAINT session_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))`,
+
+		`CREATE INDEX session_account_id_IDX ON session(account_id)`,
+	},
+}, {
+	// Only the hash of token is saved, the token itself is shown once when created.
+	Version:     10,
+	Description: "Add API tokens",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS api_token(
+		id INTEGER NOT NULL,
+		account_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		read_only INTEGER NOT NULL DEFAULT 0,
+		created TEXT NOT NULL,
+		last_used TEXT DEFAULT NULL,
+		CONSTRAINT api_token_PK PRIMARY KEY(id),
+		CONSTRAINT api_token_hash_UNIQUE UNIQUE(hash),
+		CONSTRAINT api_token_name_UNIQUE UNIQUE(account_id, name),
+		CONSTRAINT api_token_account_id_FK FOREIGN KEY(account_id) REFERENCES account(id))`,
+	},
+}, {
+	// Events keep the submitted username, since it may not belong to any account.
+	Version:     11,
+	Description: "Add audit log of logins",
+	statements: []string{
+		`CREATE TABLE IF NOT EXISTS auth_event(
+		id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		username TEXT NOT NULL,
+		address TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created TEXT NOT NULL,
+		CONSTRAINT auth_event_PK PRIMARY KEY(id))`,
+
+		`CREATE INDEX auth_event_username_IDX ON auth_event(username)`,
+	},
+}, {
+	Version:     12,
+	Description: "Add public flag of bookmarks",
+	statements: []string{
+		`ALTER TABLE bookmark ADD COLUMN public INTEGER NOT NULL DEFAULT 0`,
+	},
+}}
+
+// sqliteLegacyVersion detects the version of SQLite database created by
+// older shiori, which made its tables without recording any schema version.
+func sqliteLegacyVersion(db *sqlx.DB) (int, error) {
+	nBookmarkTable := 0
+	err := db.Get(&nBookmarkTable, `SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name = 'bookmark'`)
+	if err != nil || nBookmarkTable == 0 {
+		return 0, err
+	}
+
+	nVideoColumn := 0
+	err = db.Get(&nVideoColumn, `SELECT COUNT(*) FROM pragma_table_info('bookmark')
+		WHERE name = 'isvideo'`)
+	if err != nil {
+		return 0, err
+	}
+
+	if nVideoColumn == 0 {
+		return 1, nil
+	}
+
+	return 2, nil
+}
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/s-frostick/shiori/model"
+)
+
+func TestSQLiteSearchBookmarks(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	testbks := []model.Bookmark{
+		{
+			URL:      "https://example.com/gardening",
+			Title:    "Gardening for beginners",
+			Content:  "Plant the seeds in spring. Golang is not needed here.",
+			Modified: "2023-05-01 10:00:00",
+			Tags:     []model.Tag{{Name: "hobby"}},
+		},
+		{
+			URL:      "https://golang.org",
+			Title:    "Golang, The Go Programming Language",
+			Content:  "Golang makes it easy to build simple, reliable & efficient <software>.",
+			Modified: "2024-02-01 10:00:00",
+			Tags:     []model.Tag{{Name: "go"}, {Name: "programming"}},
+		},
+		{
+			URL:      "https://video.example.com/apple",
+			Title:    "Apple pie recipe",
+			Content:  "Mix the apples with sugar and cinnamon.",
+			Modified: "2024-03-01 10:00:00",
+			IsVideo:  true,
+			Tags:     []model.Tag{{Name: "hobby"}, {Name: "food"}},
+		},
+	}
+	for _, book := range testbks {
+		if _, err := db.CreateBookmark(book); err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		order   SortOrder
+		keyword string
+		want    []string
+	}{
+		{SortRelevance, "", []string{"Gardening for beginners", "Golang, The Go Programming Language", "Apple pie recipe"}},
+		{SortNewest, "", []string{"Apple pie recipe", "Golang, The Go Programming Language", "Gardening for beginners"}},
+		{SortOldest, "", []string{"Gardening for beginners", "Golang, The Go Programming Language", "Apple pie recipe"}},
+		{SortTitle, "", []string{"Apple pie recipe", "Gardening for beginners", "Golang, The Go Programming Language"}},
+		{SortRelevance, "golang", []string{"Golang, The Go Programming Language", "Gardening for beginners"}},
+		{SortTitle, "golang", []string{"Gardening for beginners", "Golang, The Go Programming Language"}},
+		{SortRelevance, "example.com", []string{"Gardening for beginners", "Apple pie recipe"}},
+		{SortOldest, `"pie recipe"`, []string{"Apple pie recipe"}},
+		{SortOldest, `"recipe pie"`, []string{}},
+		{SortOldest, "golang -tag:go", []string{"Gardening for beginners"}},
+		{SortOldest, "tag:hobby", []string{"Gardening for beginners", "Apple pie recipe"}},
+		{SortOldest, "#hobby NOT #food", []string{"Gardening for beginners"}},
+		{SortOldest, "tag:go OR tag:food", []string{"Golang, The Go Programming Language", "Apple pie recipe"}},
+		{SortOldest, "site:example.com", []string{"Gardening for beginners", "Apple pie recipe"}},
+		{SortOldest, "site:golang.org", []string{"Golang, The Go Programming Language"}},
+		{SortOldest, "site:ample.com", []string{}},
+		{SortOldest, "site:exampl_.com", []string{}},
+		{SortOldest, "site:%.com", []string{}},
+		{SortOldest, "exampl_", []string{}},
+		{SortOldest, "after:2024-01-01", []string{"Golang, The Go Programming Language", "Apple pie recipe"}},
+		{SortOldest, "before:2024-03-01", []string{"Gardening for beginners", "Golang, The Go Programming Language"}},
+		{SortOldest, "is:video", []string{"Apple pie recipe"}},
+		{SortOldest, "-is:video (seeds OR cinnamon OR efficient)", []string{"Gardening for beginners", "Golang, The Go Programming Language"}},
+		{SortOldest, `"pie" AND NOT sugar`, []string{}},
+	}
+
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.keyword)
+		if err != nil {
+			t.Errorf("%q: failed to parse query: %v", tt.keyword, err)
+			continue
+		}
+
+		bookmarks, _, err := db.SearchBookmarks(tt.order, Page{}, query)
+		if err != nil {
+			t.Errorf("%s %q: got unexpected error: %v", tt.order, tt.keyword, err)
+			continue
+		}
+
+		titles := []string{}
+		for _, book := range bookmarks {
+			titles = append(titles, book.Title)
+		}
+		if strings.Join(titles, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s %q: expected %v, got %v", tt.order, tt.keyword, tt.want, titles)
+		}
+	}
+
+	// Snippet must highlight the keyword and escape the content
+	query, _ := ParseQuery("golang")
+	bookmarks, _, err := db.SearchBookmarks(SortRelevance, Page{}, query)
+	if err != nil || len(bookmarks) == 0 {
+		t.Fatalf("expected search result, got %d (%v)", len(bookmarks), err)
+	}
+
+	want := "<mark>Golang</mark> makes it easy to build simple, reliable &amp; efficient &lt;software&gt;."
+	if bookmarks[0].Snippet != want {
+		t.Errorf("expected snippet %q, got %q", want, bookmarks[0].Snippet)
+	}
+}
+
+func TestSQLitePagination(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		_, err := db.CreateBookmark(model.Bookmark{
+			URL:   fmt.Sprintf("https://example.com/%d", i),
+			Title: fmt.Sprintf("Example %d", i),
+		})
+		if err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		page  Page
+		want  []int64
+		total int
+	}{
+		{Page{}, []int64{1, 2, 3, 4, 5}, 5},
+		{Page{Limit: 2}, []int64{1, 2}, 5},
+		{Page{Limit: 2, Offset: 4}, []int64{5}, 5},
+		{Page{Limit: 2, Offset: 6}, []int64{}, 5},
+	}
+
+	for _, tt := range tests {
+		bookmarks, total, err := db.SearchBookmarks(SortOldest, tt.page, Query{})
+		if err != nil {
+			t.Errorf("%+v: got unexpected error: %v", tt.page, err)
+			continue
+		}
+		if total != tt.total {
+			t.Errorf("%+v: expected total %d, got %d", tt.page, tt.total, total)
+		}
+
+		ids := []int64{}
+		for _, book := range bookmarks {
+			ids = append(ids, book.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("%+v: expected bookmarks %v, got %v", tt.page, tt.want, ids)
+		}
+
+		bookmarks, err = db.GetBookmarks(false, tt.page)
+		if err != nil || len(bookmarks) != len(tt.want) {
+			t.Errorf("%+v: expected %d bookmarks, got %d (%v)", tt.page, len(tt.want), len(bookmarks), err)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	tests := []struct {
+		limit   int
+		number  int
+		want    Page
+		wantErr bool
+	}{
+		{0, 1, Page{}, false},
+		{20, 1, Page{Limit: 20}, false},
+		{20, 3, Page{Limit: 20, Offset: 40}, false},
+		{0, 2, Page{}, true},
+		{-1, 1, Page{}, true},
+		{20, 0, Page{}, true},
+	}
+
+	for _, tt := range tests {
+		page, err := NewPage(tt.limit, tt.number)
+		if (err != nil) != tt.wantErr || page != tt.want {
+			t.Errorf("%d, %d: expected %+v (error %v), got %+v (%v)", tt.limit, tt.number, tt.want, tt.wantErr, page, err)
+		}
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    SortOrder
+		wantErr bool
+	}{
+		{"", SortRelevance, false},
+		{"newest", SortNewest, false},
+		{" Title ", SortTitle, false},
+		{"random", "", true},
+	}
+
+	for _, tt := range tests {
+		order, err := ParseSortOrder(tt.name)
+		if (err != nil) != tt.wantErr || order != tt.want {
+			t.Errorf("%q: expected %q (error %v), got %q (%v)", tt.name, tt.want, tt.wantErr, order, err)
+		}
+	}
+}
+
+func TestSQLiteTrash(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	for i := 1; i <= 4; i++ {
+		_, err := db.CreateBookmark(model.Bookmark{
+			URL:     fmt.Sprintf("https://example.com/%d", i),
+			Title:   fmt.Sprintf("Example %d", i),
+			Content: "trash content",
+			Tags:    []model.Tag{{Name: "trash"}},
+		})
+		if err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	// Deleted bookmarks are hidden, but kept in trash
+	if err := db.DeleteBookmarks("1-2", "4"); err != nil {
+		t.Fatalf("failed to delete bookmarks: %v", err)
+	}
+
+	bookmarks, err := db.GetBookmarks(false, Page{})
+	if err != nil || len(bookmarks) != 1 || bookmarks[0].ID != 3 {
+		t.Errorf("expected only bookmark 3, got %v (%v)", bookmarks, err)
+	}
+
+	query, _ := ParseQuery("content")
+	_, total, err := db.SearchBookmarks(SortRelevance, Page{}, query)
+	if err != nil || total != 1 {
+		t.Errorf("expected 1 search result, got %d (%v)", total, err)
+	}
+
+	tags, err := db.GetTags()
+	if err != nil || len(tags) != 1 || tags[0].NBookmarks != 1 {
+		t.Errorf("expected tag with 1 bookmark, got %+v (%v)", tags, err)
+	}
+
+	// Bookmark in trash can't be updated
+	_, err = db.UpdateBookmarks([]model.Bookmark{{ID: 4, URL: "https://example.com/4", Title: "Changed"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error updating deleted bookmark, got %v", err)
+	}
+
+	trash, total, err := db.GetDeletedBookmarks(Page{Limit: 2})
+	if err != nil || total != 3 || len(trash) != 2 {
+		t.Fatalf("expected 2 of 3 bookmarks in trash, got %d of %d (%v)", len(trash), total, err)
+	}
+	if trash[0].Deleted == "" || len(trash[0].Tags) != 1 {
+		t.Errorf("expected deletion time and tags, got %+v", trash[0])
+	}
+
+	// Restore brings the bookmark back with the same index
+	nRestored, err := db.RestoreBookmarks("2", "3")
+	if err != nil || nRestored != 1 {
+		t.Errorf("expected 1 restored bookmark, got %d (%v)", nRestored, err)
+	}
+
+	bookmarks, err = db.GetBookmarks(false, Page{}, "2")
+	if err != nil || len(bookmarks) != 1 {
+		t.Errorf("expected restored bookmark 2, got %v (%v)", bookmarks, err)
+	}
+
+	// Purge only removes bookmarks deleted before the time
+	nPurged, err := db.PurgeBookmarks(time.Now().Add(-time.Hour))
+	if err != nil || nPurged != 0 {
+		t.Errorf("expected no purged bookmark, got %d (%v)", nPurged, err)
+	}
+
+	nPurged, err = db.PurgeBookmarks(time.Now().Add(time.Hour), "1")
+	if err != nil || nPurged != 1 {
+		t.Errorf("expected 1 purged bookmark, got %d (%v)", nPurged, err)
+	}
+
+	nPurged, err = db.PurgeBookmarks(time.Time{})
+	if err != nil || nPurged != 1 {
+		t.Errorf("expected 1 purged bookmark, got %d (%v)", nPurged, err)
+	}
+
+	_, total, err = db.GetDeletedBookmarks(Page{})
+	if err != nil || total != 0 {
+		t.Errorf("expected empty trash, got %d (%v)", total, err)
+	}
+
+	// Purged URL can be saved again
+	if _, err = db.CreateBookmark(model.Bookmark{URL: "https://example.com/1", Title: "Example 1"}); err != nil {
+		t.Errorf("failed to save purged URL again: %v", err)
+	}
+}
+
+func TestSQLiteStableIndex(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		_, err := db.CreateBookmark(model.Bookmark{
+			URL:   fmt.Sprintf("https://example.com/%d", i),
+			Title: fmt.Sprintf("Example %d", i),
+		})
+		if err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+	}
+
+	// Huge range must not be expanded into SQL variables
+	bookmarks, err := db.GetBookmarks(false, Page{}, "2-100000000")
+	if err != nil || len(bookmarks) != 2 {
+		t.Errorf("expected 2 bookmarks, got %d (%v)", len(bookmarks), err)
+	}
+
+	// Removing the last bookmark must not make its ID reused
+	if err = db.DeleteBookmarks("1", "3-100000000"); err != nil {
+		t.Fatalf("failed to delete bookmarks: %v", err)
+	}
+	if _, err = db.PurgeBookmarks(time.Time{}); err != nil {
+		t.Fatalf("failed to purge bookmarks: %v", err)
+	}
+
+	id, err := db.CreateBookmark(model.Bookmark{URL: "https://example.com/4", Title: "Example 4"})
+	if err != nil || id != 4 {
+		t.Errorf("expected new bookmark with ID 4, got %d (%v)", id, err)
+	}
+
+	bookmarks, err = db.GetBookmarks(false, Page{}, "2")
+	if err != nil || len(bookmarks) != 1 || bookmarks[0].Title != "Example 2" {
+		t.Errorf("expected bookmark 2 to keep its index, got %v (%v)", bookmarks, err)
+	}
+}
+
+func TestSQLiteDeleteUnusedVideos(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	// The first two bookmarks share the file of the same video
+	for i, filename := range []string{"shared.mp4", "shared.mp4", "single.mp4"} {
+		id, err := db.CreateBookmark(model.Bookmark{
+			URL:   fmt.Sprintf("https://example.com/%d", i+1),
+			Title: fmt.Sprintf("Example %d", i+1),
+		})
+		if err != nil {
+			t.Fatalf("failed to create testing bookmarks: %v", err)
+		}
+
+		if _, err = db.CreateVideo(id, model.Video{Filename: filename, Downloaded: true}); err != nil {
+			t.Fatalf("failed to create testing video: %v", err)
+		}
+	}
+
+	purge := func(indices ...string) string {
+		if err := db.DeleteBookmarks(indices...); err != nil {
+			t.Fatalf("failed to delete bookmarks: %v", err)
+		}
+		if _, err := db.PurgeBookmarks(time.Time{}); err != nil {
+			t.Fatalf("failed to purge bookmarks: %v", err)
+		}
+
+		filenames, err := db.DeleteUnusedVideos()
+		if err != nil {
+			t.Fatalf("failed to delete unused videos: %v", err)
+		}
+		return strings.Join(filenames, ",")
+	}
+
+	// File is only unused once every bookmark of the video is purged
+	if got := purge("1", "3"); got != "single.mp4" {
+		t.Errorf("expected single.mp4 to be unused, got %q", got)
+	}
+	if ids, err := db.GetVideoBookmarks("shared.mp4"); err != nil || len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("expected shared.mp4 to be kept for bookmark 2, got %v (%v)", ids, err)
+	}
+
+	if got := purge("2"); got != "shared.mp4" {
+		t.Errorf("expected shared.mp4 to be unused, got %q", got)
+	}
+
+	nVideos := -1
+	if err := db.Get(&nVideos, `SELECT COUNT(*) FROM video`); err != nil || nVideos != 0 {
+		t.Errorf("expected no video left, got %d (%v)", nVideos, err)
+	}
+}
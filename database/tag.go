@@ -0,0 +1,38 @@
+package database
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Tag can be hierarchical, where the name of each ancestor is separated by slash.
+// For example "dev/go/testing" is child of "dev/go", which is child of "dev".
+
+// NormalizeTagName lowercases the tag name and cleans up its path,
+// so " Dev / Go/ " becomes "dev/go".
+func NormalizeTagName(name string) string {
+	parts := []string{}
+	for _, part := range strings.Split(strings.ToLower(name), "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// parentTagName returns the name of parent tag, or empty string for top level tag.
+func parentTagName(name string) string {
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		return name[:idx]
+	}
+
+	return ""
+}
+
+// descendantPrefix returns the prefix shared by the names of tag's descendants,
+// with its length in characters to be compared using SQL substr function.
+func descendantPrefix(name string) (string, int) {
+	prefix := name + "/"
+	return prefix, utf8.RuneCountInString(prefix)
+}
@@ -0,0 +1,52 @@
+-- Schema and data of a database created by shiori before video support
+-- and schema_version were added. Tables were created on every start
+-- with CREATE TABLE IF NOT EXISTS, so nothing records the version.
+CREATE TABLE account(
+	id INTEGER NOT NULL,
+	username TEXT NOT NULL,
+	password TEXT NOT NULL,
+	CONSTRAINT account_PK PRIMARY KEY(id),
+	CONSTRAINT account_username_UNIQUE UNIQUE(username));
+
+CREATE TABLE bookmark(
+	id INTEGER NOT NULL,
+	url TEXT NOT NULL,
+	title TEXT NOT NULL,
+	image_url TEXT NOT NULL DEFAULT "",
+	excerpt TEXT NOT NULL DEFAULT "",
+	author TEXT NOT NULL DEFAULT "",
+	min_read_time INTEGER NOT NULL DEFAULT 0,
+	max_read_time INTEGER NOT NULL DEFAULT 0,
+	modified TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT bookmark_PK PRIMARY KEY(id),
+	CONSTRAINT bookmark_url_UNIQUE UNIQUE(url));
+
+CREATE TABLE tag(
+	id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	CONSTRAINT tag_PK PRIMARY KEY(id),
+	CONSTRAINT tag_name_UNIQUE UNIQUE(name));
+
+CREATE TABLE bookmark_tag(
+	bookmark_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	CONSTRAINT bookmark_tag_PK PRIMARY KEY(bookmark_id, tag_id),
+	CONSTRAINT bookmark_id_FK FOREIGN KEY(bookmark_id) REFERENCES bookmark(id),
+	CONSTRAINT tag_id_FK FOREIGN KEY(tag_id) REFERENCES tag(id));
+
+CREATE VIRTUAL TABLE bookmark_content USING fts4(title, content, html);
+
+INSERT INTO account (id, username, password) VALUES
+	(1, 'shiori', '$2a$10$Xv1yY3hJfSPaEEfHq8YTPOUDa3.Q0eBk3kAx/EB0lbwYDUcDN9oVm');
+
+INSERT INTO bookmark (id, url, title, excerpt, modified) VALUES
+	(1, 'https://github.com/s-frostick/shiori', 'Shiori', 'Simple bookmark manager', '2018-03-01 10:00:00'),
+	(2, 'https://golang.org', 'The Go Programming Language', '', '2018-03-02 10:00:00');
+
+INSERT INTO tag (id, name) VALUES (1, 'go'), (2, 'bookmark');
+
+INSERT INTO bookmark_tag (bookmark_id, tag_id) VALUES (1, 1), (1, 2), (2, 1);
+
+INSERT INTO bookmark_content (docid, title, content, html) VALUES
+	(1, 'Shiori', 'Shiori is a simple bookmarks manager written in Go', '<p>Shiori</p>'),
+	(2, 'The Go Programming Language', 'Go is an open source programming language', '<p>Go</p>');
@@ -2,16 +2,36 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/user"
 	fp "path/filepath"
+	"strings"
 
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/s-frostick/shiori/cmd"
 	db "github.com/s-frostick/shiori/database"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	cmd.OpenDatabase = openDatabase
+	cmd.Execute()
+}
+
+func openDatabase(dbms string) (db.Database, error) {
+	// If database server is chosen, connect to it using its DSN
+	switch strings.ToLower(dbms) {
+	case "", "sqlite":
+	case "mysql":
+		return db.OpenMySQLDatabase(os.Getenv("ENV_SHIORI_MYSQL_DSN"))
+	case "postgresql":
+		return db.OpenPostgresDatabase(os.Getenv("ENV_SHIORI_PG_DSN"))
+	default:
+		return nil, fmt.Errorf("Unknown DBMS %q, expected sqlite, mysql or postgresql", dbms)
+	}
+
 	databasePath := fp.Join(getHomeDir(), ".shiori.db")
 	if value, found := os.LookupEnv("ENV_SHIORI_DB"); found {
 		// If ENV_SHIORI_DB is directory, append ".shiori.db" as filename
@@ -22,11 +42,7 @@ func main() {
 		databasePath = value
 	}
 
-	sqliteDB, err := db.OpenSQLiteDatabase(databasePath)
-	checkError(err)
-
-	cmd.DB = sqliteDB
-	cmd.Execute()
+	return db.OpenSQLiteDatabase(databasePath)
 }
 
 func getHomeDir() string {
@@ -37,9 +53,3 @@ func getHomeDir() string {
 
 	return user.HomeDir
 }
-
-func checkError(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shiori")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("ENV_SHIORI_DB", filepath.Join(dir, "shiori.db"))
+	defer os.Unsetenv("ENV_SHIORI_DB")
+
+	for _, dbms := range []string{"", "sqlite", "SQLite"} {
+		if _, err := openDatabase(dbms); err != nil {
+			t.Errorf("%q: expected SQLite database, got %v", dbms, err)
+		}
+	}
+
+	// Unknown DBMS doesn't fall back to SQLite
+	for _, dbms := range []string{"mariadb", "postgres", "mysq"} {
+		if _, err := openDatabase(dbms); err == nil || !strings.Contains(err.Error(), "Unknown DBMS") {
+			t.Errorf("%q: expected unknown DBMS error, got %v", dbms, err)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Tag is tag for the bookmark
 type Tag struct {
 	ID         int64  `db:"id"          json:"id"`
 	Name       string `db:"name"        json:"name"`
+	ParentID   int64  `db:"parent_id"   json:"parentId,omitempty"`
 	NBookmarks int64  `db:"n_bookmarks" json:"nBookmarks"`
 	Deleted    bool   `json:"-"`
 }
@@ -21,6 +27,9 @@ type Bookmark struct {
 	Modified    string `db:"modified"      json:"modified"`
 	Content     string `db:"content"       json:"-"`
 	HTML        string `db:"html"          json:"-"`
+	Snippet     string `db:"snippet"       json:"snippet,omitempty"`
+	Deleted     string `db:"deleted"       json:"deleted,omitempty"`
+	Public      bool   `db:"public"        json:"public"`
 	Tags        []Tag  `json:"tags"`
     IsVideo     bool   `db:"isvideo"       json:"isvideo"`
     Downloaded  bool   `db:"downloaded"  json:"downloaded"`
@@ -33,11 +42,70 @@ type Video struct {
    Filename  string `db:"filename" json:"filename"`
 }
 
+// BookmarkPage is a page of bookmarks returned by API
+type BookmarkPage struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+	Page      int        `json:"page"`
+	Limit     int        `json:"limit"`
+	Total     int        `json:"total"`
+}
+
 // Account is account for accessing bookmarks from web interface
 type Account struct {
 	ID       int64  `db:"id"       json:"id"`
 	Username string `db:"username" json:"username"`
-	Password string `db:"password" json:"password"`
+	Password string `db:"password" json:"-"`
+	Role     string `db:"role"     json:"role"`
+}
+
+// Session is login session of account, which is revoked once it's deleted
+type Session struct {
+	ID        string `db:"id"         json:"id"`
+	AccountID int64  `db:"account_id" json:"accountId"`
+	Username  string `db:"username"   json:"username"`
+	Created   string `db:"created"    json:"created"`
+	Expires   string `db:"expires"    json:"expires"`
+}
+
+// APIToken is long-lived token for accessing API without login
+type APIToken struct {
+	ID        int64  `db:"id"         json:"id"`
+	AccountID int64  `db:"account_id" json:"accountId"`
+	Username  string `db:"username"   json:"username"`
+	Name      string `db:"name"       json:"name"`
+	Hash      string `db:"hash"       json:"-"`
+	ReadOnly  bool   `db:"read_only"  json:"readOnly"`
+	Created   string `db:"created"    json:"created"`
+	LastUsed  string `db:"last_used"  json:"lastUsed,omitempty"`
+}
+
+// AuthEvent is record of login attempt in audit log
+type AuthEvent struct {
+	ID       int64  `db:"id"       json:"id"`
+	Event    string `db:"event"    json:"event"`
+	Username string `db:"username" json:"username"`
+	Address  string `db:"address"  json:"address"`
+	Message  string `db:"message"  json:"message"`
+	Created  string `db:"created"  json:"created"`
+}
+
+// PublicRequest is request to share or stop sharing bookmarks
+type PublicRequest struct {
+	IDs    []string `json:"ids"`
+	Public bool     `json:"public"`
+}
+
+// AccountRequest is request to create new account
+type AccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// PasswordRequest is request to change password of account
+type PasswordRequest struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
 }
 
 // LoginRequest is login request
@@ -46,3 +114,82 @@ type LoginRequest struct {
 	Password string `json:"password"`
 	Remember bool   `json:"remember"`
 }
+
+// ErrorResponse is the response of API when request fails
+type ErrorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// BookmarkContent is the readable content and archived HTML of bookmark
+type BookmarkContent struct {
+	ID      int64  `json:"id"`
+	Content string `json:"content"`
+	HTML    string `json:"html"`
+}
+
+// BookmarkPatch is JSON merge patch of bookmark, which only changes the fields in it.
+// Missing field is nil, while null field becomes empty value, so it clears the field.
+// Tags replace every current tag of bookmark.
+type BookmarkPatch struct {
+	URL      *string `json:"url,omitempty"`
+	Title    *string `json:"title,omitempty"`
+	Excerpt  *string `json:"excerpt,omitempty"`
+	Author   *string `json:"author,omitempty"`
+	ImageURL *string `json:"imageURL,omitempty"`
+	Tags     *[]Tag  `json:"tags,omitempty"`
+	Public   *bool   `json:"public,omitempty"`
+}
+
+// UnmarshalJSON decodes merge patch. Unknown field is refused, so typo
+// or read-only field doesn't look like it has been changed.
+func (p *BookmarkPatch) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*p = BookmarkPatch{}
+	for name, value := range fields {
+		var err error
+		switch name {
+		case "url":
+			p.URL, err = patchString(value)
+		case "title":
+			p.Title, err = patchString(value)
+		case "excerpt":
+			p.Excerpt, err = patchString(value)
+		case "author":
+			p.Author, err = patchString(value)
+		case "imageURL":
+			p.ImageURL, err = patchString(value)
+		case "tags":
+			tags := []Tag{}
+			err = json.Unmarshal(value, &tags)
+			if tags == nil {
+				tags = []Tag{}
+			}
+			p.Tags = &tags
+		case "public":
+			public := false
+			err = json.Unmarshal(value, &public)
+			p.Public = &public
+		default:
+			err = fmt.Errorf("field can't be changed")
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// patchString decodes string field of merge patch, where null becomes empty string.
+func patchString(value json.RawMessage) (*string, error) {
+	s := ""
+	err := json.Unmarshal(value, &s)
+	return &s, err
+}
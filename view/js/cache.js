@@ -0,0 +1,22 @@
+var useDarkMode = localStorage.getItem('dark-mode') !== null,
+    cachePage = document.getElementById('cache-page'),
+    btnToggleLight = document.getElementById('toggle-light');
+
+function updatePage() {
+    if (useDarkMode) {
+        localStorage.setItem('dark-mode', '');
+        cachePage.className = 'dark-mode';
+        btnToggleLight.innerHTML = '<i class="fas fa-fw fa-sun"></i> Use light mode</a>';
+    } else {
+        localStorage.removeItem('dark-mode');
+        cachePage.removeAttribute('class');
+        btnToggleLight.innerHTML = '<i class="fas fa-fw fa-moon"></i> Use dark mode</a>';
+    }
+}
+
+btnToggleLight.onclick = function () {
+    useDarkMode = !useDarkMode;
+    updatePage();
+};
+
+updatePage();